@@ -2,16 +2,20 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rcbadiale/go_open_telemetry/internals/config"
 	"github.com/rcbadiale/go_open_telemetry/internals/handlers"
 	"github.com/rcbadiale/go_open_telemetry/internals/server"
-	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
 	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"github.com/rcbadiale/go_open_telemetry/pkg/redact"
 	"github.com/rcbadiale/go_open_telemetry/pkg/telemetry"
 	"github.com/riandyrn/otelchi"
 	"go.opentelemetry.io/otel"
@@ -19,41 +23,64 @@ import (
 )
 
 func main() {
+	cfg, err := config.LoadInputService(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Printed before the logger is installed, so no log line is mixed in
+	if cfg.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	// The redactor is installed before the logger, so no log line is written
+	// without the configured redaction
+	redact.SetDefault(redact.New(cfg.Redact.QueryParams, cfg.Redact.Headers))
 	logger := logging.SetupLogger()
-	logging.Logger.Info("Starting input service at :8080")
-	if err := run(logger); err != nil {
-		logging.Logger.Error("Failed to run the server", err)
+
+	logging.Logger.Info("Starting input service", "port", cfg.Server.Port)
+	if err := run(logger, cfg); err != nil {
+		logging.Logger.Error("Failed to run the server", "error", err)
 		panic(err)
 	}
 }
 
-func run(logger *log.Logger) (err error) {
-	serviceName := environment.GetEnvOrDefault("SERVICE_NAME", "input-service")
+func run(logger *log.Logger, cfg *config.InputService) (err error) {
+	serviceName := cfg.Server.ServiceName
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
 
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	otelEndpoint := environment.GetEnvOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", "localhost:4317")
-	shutdown, err := telemetry.InitProvider(ctx, serviceName, otelEndpoint)
+	telemetryProvider, err := telemetry.InitProvider(ctx, serviceName, cfg.Telemetry)
 	if err != nil {
-		log.Fatal(err)
+		// Telemetry is not critical, the service keeps running without it
+		logging.Logger.Error("failed to initialize telemetry, running without it", "error", err)
+	} else {
+		defer func() {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer shutdownCancel()
+			if err := telemetryProvider.Shutdown(shutdownCtx); err != nil {
+				logging.Logger.Error("failed to shutdown telemetry providers", "error", err)
+			}
+		}()
 	}
-	defer func() {
-		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TraceProvider", err)
-		}
-	}()
 
 	tracer := otel.Tracer(serviceName)
-	r := setupHandler(tracer, serviceName)
+	r := setupHandler(cfg, tracer, serviceName)
 
-	srv := server.StartServer(ctx, r, ":8080", logger)
+	srv := server.StartServer(ctx, r, fmt.Sprintf(":%d", cfg.Server.Port), logger)
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
-			logging.Logger.Error("failed to start server: %v", err)
+			logging.Logger.Error("failed to start server", "error", err)
 		}
 	}()
 
@@ -70,17 +97,19 @@ func run(logger *log.Logger) (err error) {
 	defer shutdownCancel()
 
 	if err := srv.Shutdown(shutdownCtx); err != nil {
-		logging.Logger.Warn("Server forced to shutdown: %v", err)
+		logging.Logger.Warn("Server forced to shutdown", "error", err)
 	}
 
 	logging.Logger.Warn("Server exiting")
 	return nil
 }
 
-func setupHandler(trace trace.Tracer, serviceName string) *chi.Mux {
+func setupHandler(cfg *config.InputService, trace trace.Tracer, serviceName string) *chi.Mux {
 	r := chi.NewRouter()
 	r.Use(otelchi.Middleware(serviceName, otelchi.WithChiRoutes(r)))
-	weatherHandler := handlers.NewOtelWeatherInputHandler(trace)
+	r.Use(server.MetricsMiddleware(serviceName))
+	r.Get("/telemetry/state", telemetry.StateHandler)
+	weatherHandler := handlers.NewOtelWeatherInputHandler(cfg.WeatherServiceURL, cfg.Upstreams, trace)
 	r.Post("/weather", weatherHandler.PostWeather)
 	// r.Handle("/metrics", promhttp.Handler())
 	return r
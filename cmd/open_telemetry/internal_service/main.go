@@ -2,16 +2,22 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
+	"github.com/rcbadiale/go_open_telemetry/internals/config"
 	"github.com/rcbadiale/go_open_telemetry/internals/handlers"
 	"github.com/rcbadiale/go_open_telemetry/internals/server"
 	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"github.com/rcbadiale/go_open_telemetry/pkg/redact"
 	"github.com/rcbadiale/go_open_telemetry/pkg/telemetry"
 	"github.com/riandyrn/otelchi"
 	"go.opentelemetry.io/otel"
@@ -19,22 +25,41 @@ import (
 )
 
 func main() {
-	logger := logging.SetupLogger()
-	err := godotenv.Load()
+	// The .env file is loaded into the environment, taking precedence over
+	// the configuration file
+	envErr := godotenv.Load()
+	cfg, err := config.LoadWeatherService(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	// Printed before the logger is installed, so no log line is mixed in
+	if cfg.PrintConfig {
+		if err := config.Print(os.Stdout, cfg); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	// The redactor is installed before the logger, so no log line is written
+	// without the configured redaction
+	redact.SetDefault(redact.New(cfg.Redact.QueryParams, cfg.Redact.Headers))
+	logger := logging.SetupLogger()
+	if envErr != nil {
 		logging.Logger.Error("error loading .env file, will use environment variables")
 	}
 
-	logging.Logger.Info("Starting server on port 8081")
-	if err := run(logger); err != nil {
-		logging.Logger.Error("Failed to run the server", err)
+	logging.Logger.Info("Starting server", "port", cfg.Server.Port)
+	if err := run(logger, cfg); err != nil {
+		logging.Logger.Error("Failed to run the server", "error", err)
 		panic(err)
 	}
 }
 
-const serviceName = "weather-service"
-
-func run(logger *log.Logger) (err error) {
+func run(logger *log.Logger, cfg *config.WeatherService) (err error) {
 	// Graceful shutdown - begin
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, os.Interrupt)
@@ -42,24 +67,42 @@ func run(logger *log.Logger) (err error) {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 	// Graceful shutdown - end
-	otelEndpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")
-	if otelEndpoint == "" {
-		otelEndpoint = "localhost:4317"
-	}
-	shutdown, err := telemetry.InitProvider(ctx, serviceName, otelEndpoint)
+	telemetryProvider, err := telemetry.InitProvider(ctx, cfg.Server.ServiceName, cfg.Telemetry)
 	if err != nil {
-		log.Fatal(err)
+		// Telemetry is not critical, the service keeps running without it
+		logging.Logger.Error("failed to initialize telemetry, running without it", "error", err)
+	} else {
+		defer func() {
+			shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer shutdownCancel()
+			if err := telemetryProvider.Shutdown(shutdownCtx); err != nil {
+				logging.Logger.Error("failed to shutdown telemetry providers", "error", err)
+			}
+		}()
 	}
+	tracer := otel.Tracer(cfg.Server.ServiceName)
+
+	r, weatherHandler := setupHandler(cfg, tracer)
 	defer func() {
-		if err := shutdown(ctx); err != nil {
-			log.Fatal("failed to shutdown TraceProvider", err)
+		if err := weatherHandler.Close(); err != nil {
+			logging.Logger.Error("failed to close weather handler", "error", err)
 		}
 	}()
-	tracer := otel.Tracer(serviceName)
 
-	r := setupHandler(tracer)
+	// Secrets are read again on SIGHUP, besides being watched
+	hupCh := make(chan os.Signal, 1)
+	signal.Notify(hupCh, syscall.SIGHUP)
+	defer signal.Stop(hupCh)
+	go func() {
+		for range hupCh {
+			logging.Logger.Info("SIGHUP received, reloading secrets")
+			if err := weatherHandler.Reload(ctx); err != nil {
+				logging.Logger.Error("failed to reload secrets", "error", err)
+			}
+		}
+	}()
 
-	srv := server.StartServer(ctx, r, ":8081", logger)
+	srv := server.StartServer(ctx, r, fmt.Sprintf(":%d", cfg.Server.Port), logger)
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil {
@@ -87,11 +130,15 @@ func run(logger *log.Logger) (err error) {
 	return nil
 }
 
-func setupHandler(trace trace.Tracer) *chi.Mux {
+func setupHandler(cfg *config.WeatherService, trace trace.Tracer) (*chi.Mux, *handlers.WeatherHandler) {
 	r := chi.NewRouter()
-	r.Use(otelchi.Middleware(serviceName, otelchi.WithChiRoutes(r)))
-	weatherApiKey := os.Getenv("WEATHER_API_KEY")
-	weatherHandler := handlers.NewWeatherHandler(weatherApiKey, trace)
+	r.Use(otelchi.Middleware(cfg.Server.ServiceName, otelchi.WithChiRoutes(r)))
+	r.Use(server.MetricsMiddleware(cfg.Server.ServiceName))
+	r.Get("/telemetry/state", telemetry.StateHandler)
+	weatherHandler := handlers.NewWeatherHandler(cfg, trace)
 	r.Get("/weather/{zipCode}", weatherHandler.GetWeather)
-	return r
+	if cfg.Admin.Token != "" {
+		r.With(server.BearerTokenMiddleware(cfg.Admin.Token)).Get("/admin/weatherapi/keys", weatherHandler.GetWeatherAPIKeys)
+	}
+	return r, weatherHandler
 }
@@ -0,0 +1,252 @@
+package internals
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrCircuitOpen is matched by the CircuitOpenError returned while a circuit
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitOpenError is returned without calling the upstream while its
+// circuit breaker is open.
+type CircuitOpenError struct {
+	Upstream string
+	// RetryAfter is the time left until the breaker lets a request through.
+	RetryAfter time.Duration
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("circuit breaker for %s is open, retry after %s", e.Upstream, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *CircuitOpenError) Is(target error) bool {
+	return target == ErrCircuitOpen
+}
+
+// CircuitState is the state of a circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets every request through.
+	CircuitClosed CircuitState = iota
+	// CircuitOpen rejects every request until the cool-down ends.
+	CircuitOpen
+	// CircuitHalfOpen lets a few probe requests through, closing the breaker
+	// when all of them succeed.
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// CircuitBreakerConfig configures the CircuitBreakerClient.
+type CircuitBreakerConfig struct {
+	// FailureThreshold is the amount of consecutive failures opening the
+	// breaker, 0 disables it.
+	FailureThreshold int
+	// CoolDown is how long the breaker stays open before probing the
+	// upstream again.
+	CoolDown time.Duration
+	// HalfOpenRequests is the amount of probe requests that must succeed to
+	// close the breaker.
+	HalfOpenRequests int
+}
+
+// CircuitBreakerConfigFromEnv reads the circuit breaker settings from
+// CIRCUIT_BREAKER_FAILURE_THRESHOLD, CIRCUIT_BREAKER_COOLDOWN and
+// CIRCUIT_BREAKER_HALF_OPEN_REQUESTS.
+func CircuitBreakerConfigFromEnv(env environment.Source) CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		FailureThreshold: env.GetIntOrDefault("CIRCUIT_BREAKER_FAILURE_THRESHOLD", 5),
+		CoolDown:         env.GetDurationOrDefault("CIRCUIT_BREAKER_COOLDOWN", 30*time.Second),
+		HalfOpenRequests: env.GetIntOrDefault("CIRCUIT_BREAKER_HALF_OPEN_REQUESTS", 1),
+	}
+}
+
+// CircuitBreakerClient stops calling an upstream after consecutive failures
+// (connection errors or 5xx), failing fast with a CircuitOpenError until the
+// cool-down ends.
+type CircuitBreakerClient struct {
+	next     HTTPClient
+	upstream string
+	config   CircuitBreakerConfig
+
+	mu        sync.Mutex
+	state     CircuitState
+	failures  int
+	probes    int
+	successes int
+	openedAt  time.Time
+
+	stateGauge  metric.Int64Gauge
+	transitions metric.Int64Counter
+}
+
+// NewCircuitBreakerClient creates a CircuitBreakerClient decorating next
+func NewCircuitBreakerClient(next HTTPClient, upstream string, config CircuitBreakerConfig) HTTPClient {
+	if config.HalfOpenRequests < 1 {
+		config.HalfOpenRequests = 1
+	}
+	meter := otel.Meter("")
+	stateGauge, err := meter.Int64Gauge(
+		"circuit_breaker.state",
+		metric.WithDescription("State of the circuit breaker: 0 closed, 1 open and 2 half-open"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	transitions, err := meter.Int64Counter(
+		"circuit_breaker.transitions",
+		metric.WithDescription("Number of circuit breaker state changes"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	c := &CircuitBreakerClient{
+		next:        next,
+		upstream:    upstream,
+		config:      config,
+		stateGauge:  stateGauge,
+		transitions: transitions,
+	}
+	c.recordState(context.Background())
+	return c
+}
+
+func (c *CircuitBreakerClient) Do(req *http.Request) (*http.Response, error) {
+	if c.config.FailureThreshold <= 0 {
+		return c.next.Do(req)
+	}
+	ctx := req.Context()
+	if err := c.allow(ctx); err != nil {
+		trace.SpanFromContext(ctx).AddEvent("Circuit breaker rejected request", trace.WithAttributes(
+			attribute.String("upstream", c.upstream),
+		))
+		return nil, err
+	}
+
+	resp, err := c.next.Do(req)
+	// Canceled and refused requests say nothing about the upstream health
+	if err != nil && ctx.Err() != nil || refused(err) {
+		c.release()
+		return resp, err
+	}
+	c.done(ctx, err == nil && resp.StatusCode < 500)
+	return resp, err
+}
+
+// allow reserves a request, moving an open breaker to half-open once the
+// cool-down ended
+func (c *CircuitBreakerClient) allow(ctx context.Context) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case CircuitOpen:
+		if remaining := c.config.CoolDown - time.Since(c.openedAt); remaining > 0 {
+			return &CircuitOpenError{Upstream: c.upstream, RetryAfter: remaining}
+		}
+		c.transition(ctx, CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		if c.probes >= c.config.HalfOpenRequests {
+			return &CircuitOpenError{Upstream: c.upstream}
+		}
+		c.probes++
+	}
+	return nil
+}
+
+// release gives back a probe whose result is unknown
+func (c *CircuitBreakerClient) release() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == CircuitHalfOpen && c.probes > 0 {
+		c.probes--
+	}
+}
+
+// done records the result of a request
+func (c *CircuitBreakerClient) done(ctx context.Context, success bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch c.state {
+	case CircuitClosed:
+		if success {
+			c.failures = 0
+		} else if c.failures++; c.failures >= c.config.FailureThreshold {
+			c.transition(ctx, CircuitOpen)
+		}
+	case CircuitHalfOpen:
+		if !success {
+			c.transition(ctx, CircuitOpen)
+		} else if c.successes++; c.successes >= c.config.HalfOpenRequests {
+			c.transition(ctx, CircuitClosed)
+		}
+	}
+}
+
+// transition changes the state, the caller must hold the lock
+func (c *CircuitBreakerClient) transition(ctx context.Context, state CircuitState) {
+	from := c.state
+	c.state = state
+	c.failures, c.probes, c.successes = 0, 0, 0
+	if state == CircuitOpen {
+		c.openedAt = time.Now()
+	}
+
+	attributes := []attribute.KeyValue{
+		attribute.String("upstream", c.upstream),
+		attribute.String("from", from.String()),
+		attribute.String("to", state.String()),
+	}
+	trace.SpanFromContext(ctx).AddEvent("Circuit breaker state changed", trace.WithAttributes(attributes...))
+	if c.transitions != nil {
+		c.transitions.Add(ctx, 1, metric.WithAttributes(attributes...))
+	}
+	c.recordState(ctx)
+	logging.Logger.WarnContext(ctx, "Circuit breaker state changed", "upstream", c.upstream, "from", from.String(), "to", state.String())
+}
+
+func (c *CircuitBreakerClient) recordState(ctx context.Context) {
+	if c.stateGauge != nil {
+		c.stateGauge.Record(ctx, int64(c.state), metric.WithAttributes(attribute.String("upstream", c.upstream)))
+	}
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c CircuitBreakerConfig) Validate() error {
+	var errs []error
+	if c.FailureThreshold < 0 {
+		errs = append(errs, errors.New("CIRCUIT_BREAKER_FAILURE_THRESHOLD can not be negative"))
+	}
+	if c.FailureThreshold > 0 && c.CoolDown <= 0 {
+		errs = append(errs, errors.New("CIRCUIT_BREAKER_COOLDOWN must be positive"))
+	}
+	if c.HalfOpenRequests < 1 {
+		errs = append(errs, errors.New("CIRCUIT_BREAKER_HALF_OPEN_REQUESTS must be at least 1"))
+	}
+	return errors.Join(errs...)
+}
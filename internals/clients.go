@@ -1,7 +1,35 @@
 package internals
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+)
 
 type HTTPClient interface {
 	Do(req *http.Request) (*http.Response, error)
 }
+
+// failingClient answers every request with err, used when a client can not
+// be created so the requests fail instead of going out misconfigured.
+type failingClient struct {
+	err error
+}
+
+// NewFailingClient creates a client failing every request with err
+func NewFailingClient(err error) HTTPClient {
+	return failingClient{err: err}
+}
+
+func (c failingClient) Do(*http.Request) (*http.Response, error) {
+	return nil, c.err
+}
+
+// ErrRefused is matched by the errors of the requests refused on purpose
+// before being sent, e.g. because a call budget ran out. They are neither
+// retried nor counted by the circuit breaker.
+var ErrRefused = errors.New("request refused")
+
+// refused reports whether the request was refused on purpose
+func refused(err error) bool {
+	return errors.Is(err, ErrRefused)
+}
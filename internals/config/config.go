@@ -0,0 +1,231 @@
+// Package config loads the typed configuration of each service. Every
+// setting is read, in this precedence, from the command line flags, the
+// environment, an optional YAML or TOML file and finally its default.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+	"github.com/rcbadiale/go_open_telemetry/internals/services"
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/redact"
+	"github.com/rcbadiale/go_open_telemetry/pkg/telemetry"
+)
+
+// Options are set on the command line and change how the service starts.
+type Options struct {
+	// File is the configuration file, set by --config or CONFIG_FILE.
+	File string
+	// PrintConfig prints the effective configuration and exits.
+	PrintConfig bool
+}
+
+// Server configures the HTTP server.
+type Server struct {
+	// Port is the port listened on, SERVICE_PORT.
+	Port int
+	// ServiceName names the service on the telemetry, SERVICE_NAME.
+	ServiceName string
+}
+
+// Redact configures what is redacted from the logs, errors and spans.
+type Redact struct {
+	// QueryParams are REDACT_QUERY_PARAMS.
+	QueryParams []string
+	// Headers are REDACT_HEADERS.
+	Headers []string
+}
+
+// Admin configures the administration endpoints.
+type Admin struct {
+	// Token is required as a bearer token by the administration endpoints,
+	// ADMIN_TOKEN. Empty disables them.
+	Token string `secret:"true"`
+}
+
+// InputService is the configuration of the input service.
+type InputService struct {
+	Options   `config:"-"`
+	Server    Server
+	Telemetry telemetry.Config
+	Redact    Redact
+	Upstreams internals.UpstreamsConfig
+	// WeatherServiceURL is the internal weather service, WEATHER_SERVICE_URL.
+	WeatherServiceURL string
+}
+
+// WeatherService is the configuration of the internal weather service.
+type WeatherService struct {
+	Options          `config:"-"`
+	Server           Server
+	Telemetry        telemetry.Config
+	Redact           Redact
+	Upstreams        internals.UpstreamsConfig
+	Admin            Admin
+	WeatherProviders services.WeatherProvidersConfig
+	CEPProviders     services.CEPProvidersConfig
+	CEPCache         services.CEPCacheConfig
+	WeatherCache     services.WeatherCacheConfig
+}
+
+// ValidationError lists every invalid setting found while loading.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, err := range e.Errors {
+		b.WriteString("\n  - ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// LoadInputService loads the input service configuration from the command
+// line args (without the program name), the environment and the
+// configuration file. The returned error is either flag.ErrHelp, a flag
+// parsing error or a *ValidationError.
+func LoadInputService(args []string) (*InputService, error) {
+	cfg := &InputService{}
+	err := load("input-service", args, &cfg.Options, func(env environment.Source) []error {
+		cfg.Server = serverFromEnv(env, 8080, "input-service")
+		cfg.Telemetry = telemetry.ConfigFromEnv(env)
+		cfg.Redact = redactFromEnv(env)
+		cfg.Upstreams = internals.UpstreamsConfigFromEnv(env, services.InternalWeatherServiceUpstream)
+		cfg.WeatherServiceURL = env.GetEnvOrDefault("WEATHER_SERVICE_URL", "http://localhost:8081")
+		errs := []error{
+			cfg.Server.Validate(),
+			cfg.Telemetry.Validate(),
+			cfg.Upstreams.Validate(),
+		}
+		if !strings.HasPrefix(cfg.WeatherServiceURL, "http://") && !strings.HasPrefix(cfg.WeatherServiceURL, "https://") {
+			errs = append(errs, fmt.Errorf("WEATHER_SERVICE_URL must be an http or https URL, got %q", cfg.WeatherServiceURL))
+		}
+		return errs
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// LoadWeatherService loads the internal weather service configuration from
+// the command line args (without the program name), the environment and the
+// configuration file. The returned error is either flag.ErrHelp, a flag
+// parsing error or a *ValidationError.
+func LoadWeatherService(args []string) (*WeatherService, error) {
+	cfg := &WeatherService{}
+	err := load("weather-service", args, &cfg.Options, func(env environment.Source) []error {
+		cfg.Server = serverFromEnv(env, 8081, "weather-service")
+		cfg.Telemetry = telemetry.ConfigFromEnv(env)
+		cfg.Redact = redactFromEnv(env)
+		cfg.Admin = Admin{Token: env.GetEnvOrDefault("ADMIN_TOKEN", "")}
+		cfg.WeatherProviders = services.WeatherProvidersConfigFromEnv(env)
+		cfg.CEPProviders = services.CEPProvidersConfigFromEnv(env)
+		upstreams := append(append([]string{}, cfg.CEPProviders.Providers...), cfg.WeatherProviders.Providers...)
+		cfg.Upstreams = internals.UpstreamsConfigFromEnv(env, upstreams...)
+		cfg.CEPCache = services.CEPCacheConfigFromEnv(env)
+		cfg.WeatherCache = services.WeatherCacheConfigFromEnv(env)
+		errs := []error{
+			cfg.Server.Validate(),
+			cfg.Telemetry.Validate(),
+			cfg.Upstreams.Validate(),
+			cfg.WeatherProviders.Validate(),
+			cfg.CEPProviders.Validate(),
+			cfg.CEPCache.Validate(),
+			cfg.WeatherCache.Validate(),
+		}
+		return errs
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// load parses the flags and the configuration file and runs read on top of
+// them, collecting the values that can not be parsed along with the errors
+// it returns.
+func load(name string, args []string, options *Options, read func(env environment.Source) []error) error {
+	flags, opts, err := parseFlags(name, args)
+	if err != nil {
+		return err
+	}
+	*options = opts
+
+	var errs []error
+	src := &source{flags: flags}
+	if opts.File != "" {
+		if src.file, err = readFile(opts.File); err != nil {
+			errs = append(errs, fmt.Errorf("configuration file: %w", err))
+		}
+	}
+	env := environment.NewSource(src.lookup, func(key, value string, _ any, err error) {
+		errs = append(errs, fmt.Errorf("%s has an invalid value %q: %w", key, value, unwrapParse(err)))
+	})
+	for _, err := range read(env) {
+		errs = append(errs, flattenErrors(err)...)
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// flattenErrors splits the errors joined by the Validate methods
+func flattenErrors(err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, err := range joined.Unwrap() {
+			errs = append(errs, flattenErrors(err)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
+
+// unwrapParse drops the strconv prefix repeating the value
+func unwrapParse(err error) error {
+	if inner := errors.Unwrap(err); inner != nil {
+		return inner
+	}
+	return err
+}
+
+func serverFromEnv(env environment.Source, port int, serviceName string) Server {
+	return Server{
+		Port:        env.GetIntOrDefault("SERVICE_PORT", port),
+		ServiceName: env.GetEnvOrDefault("SERVICE_NAME", serviceName),
+	}
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (s Server) Validate() error {
+	var errs []error
+	if s.Port < 1 || s.Port > 65535 {
+		errs = append(errs, fmt.Errorf("SERVICE_PORT must be between 1 and 65535, got %d", s.Port))
+	}
+	if strings.TrimSpace(s.ServiceName) == "" {
+		errs = append(errs, errors.New("SERVICE_NAME can not be empty"))
+	}
+	return errors.Join(errs...)
+}
+
+func redactFromEnv(env environment.Source) Redact {
+	return Redact{
+		QueryParams: env.GetListOrDefault("REDACT_QUERY_PARAMS", redact.DefaultQueryParams),
+		Headers:     env.GetListOrDefault("REDACT_HEADERS", redact.DefaultHeaders),
+	}
+}
@@ -0,0 +1,109 @@
+package config
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Masked is printed in place of the secrets
+const Masked = "****"
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// Print writes cfg as YAML, keeping the field order, with the fields tagged
+// secret:"true" masked. Fields tagged config:"-" are left out.
+func Print(w io.Writer, cfg any) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(node(reflect.ValueOf(cfg), false)); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+func node(value reflect.Value, secret bool) *yaml.Node {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return scalar("", "!!null")
+		}
+		value = value.Elem()
+	}
+	if secret {
+		return mask(value)
+	}
+	switch {
+	case value.Type() == durationType:
+		return scalar(value.Interface().(time.Duration).String(), "!!str")
+	case value.Kind() == reflect.Struct:
+		n := &yaml.Node{Kind: yaml.MappingNode}
+		for i := 0; i < value.NumField(); i++ {
+			field := value.Type().Field(i)
+			if !field.IsExported() || field.Tag.Get("config") == "-" {
+				continue
+			}
+			n.Content = append(n.Content,
+				scalar(snakeCase(field.Name), "!!str"),
+				node(value.Field(i), field.Tag.Get("secret") == "true"),
+			)
+		}
+		return n
+	case value.Kind() == reflect.Slice:
+		n := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		if value.Type().Elem().Kind() == reflect.Struct {
+			// Lists of settings, e.g. the HTTP client of each upstream
+			n.Style = 0
+		}
+		for i := 0; i < value.Len(); i++ {
+			n.Content = append(n.Content, node(value.Index(i), false))
+		}
+		return n
+	case value.Kind() == reflect.String:
+		return scalar(value.String(), "!!str")
+	default:
+		n := &yaml.Node{}
+		n.Encode(value.Interface())
+		return n
+	}
+}
+
+// mask hides a secret, telling whether it is set and, for lists, how many
+// values are set
+func mask(value reflect.Value) *yaml.Node {
+	if value.Kind() == reflect.Slice {
+		n := &yaml.Node{Kind: yaml.SequenceNode, Style: yaml.FlowStyle}
+		for i := 0; i < value.Len(); i++ {
+			n.Content = append(n.Content, scalar(Masked, "!!str"))
+		}
+		return n
+	}
+	if value.IsZero() {
+		return scalar("", "!!str")
+	}
+	return scalar(Masked, "!!str")
+}
+
+func scalar(value, tag string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: value}
+}
+
+// snakeCase converts a field name, e.g. OpenWeatherMapAPIKey becomes
+// open_weather_map_api_key
+func snakeCase(name string) string {
+	var b strings.Builder
+	runes := []rune(name)
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && (unicode.IsLower(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// source layers where the settings are read from, the first one setting a
+// key wins: command line flags, environment and the configuration file.
+type source struct {
+	flags map[string]string
+	file  map[string]string
+}
+
+func (s *source) lookup(key string) (string, bool) {
+	if value, ok := s.flags[key]; ok {
+		return value, true
+	}
+	if value, ok := os.LookupEnv(key); ok {
+		return value, true
+	}
+	value, ok := s.file[key]
+	return value, ok
+}
+
+// settings collects the KEY=VALUE pairs set through --set
+type settings map[string]string
+
+func (s settings) String() string {
+	pairs := make([]string, 0, len(s))
+	for key, value := range s {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (s settings) Set(pair string) error {
+	key, value, ok := strings.Cut(pair, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", pair)
+	}
+	s[strings.ToUpper(strings.TrimSpace(key))] = value
+	return nil
+}
+
+// parseFlags reads the command line flags, returning the settings they set
+// and the options
+func parseFlags(name string, args []string) (map[string]string, Options, error) {
+	var options Options
+	var port int
+	set := settings{}
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&options.File, "config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration `file`, defaults to CONFIG_FILE")
+	flags.BoolVar(&options.PrintConfig, "print-config", false, "print the effective configuration, with secrets masked, and exit")
+	flags.IntVar(&port, "port", 0, "port to listen on, same as --set SERVICE_PORT=`port`")
+	flags.Var(set, "set", "set a variable, e.g. --set WEATHER_CACHE_TTL=5m, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return nil, options, err
+	}
+	if flags.NArg() > 0 {
+		return nil, options, fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "port" {
+			set["SERVICE_PORT"] = strconv.Itoa(port)
+		}
+	})
+	return set, options, nil
+}
+
+// readFile reads a YAML (.yaml, .yml) or TOML (.toml) configuration file.
+// Nested keys are joined by "_" and upper cased into the variable names, so
+// weather_cache: {ttl: 15m} sets WEATHER_CACHE_TTL, and lists are joined by
+// ",".
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var document map[string]any
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &document)
+	case ".toml":
+		err = toml.Unmarshal(data, &document)
+	default:
+		return nil, fmt.Errorf("unsupported configuration file extension %q, expected .yaml, .yml or .toml", ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	values := map[string]string{}
+	if err := flatten("", document, values); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return values, nil
+}
+
+func flatten(prefix string, value any, values map[string]string) error {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			if err := flatten(name, item, values); err != nil {
+				return err
+			}
+		}
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]any, []any:
+				return fmt.Errorf("%s: lists may only hold plain values", prefix)
+			}
+			items = append(items, fmt.Sprint(item))
+		}
+		values[prefix] = strings.Join(items, ",")
+	case nil:
+		values[prefix] = ""
+	default:
+		values[prefix] = fmt.Sprint(v)
+	}
+	return nil
+}
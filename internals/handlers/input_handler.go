@@ -2,8 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/rcbadiale/go_open_telemetry/internals"
 	"github.com/rcbadiale/go_open_telemetry/internals/services"
 	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
 	"go.opentelemetry.io/otel"
@@ -27,9 +29,9 @@ type OtelWeatherInputHandler struct {
 	OTELTracer      trace.Tracer
 }
 
-func NewOtelWeatherInputHandler(trace trace.Tracer) *OtelWeatherInputHandler {
+func NewOtelWeatherInputHandler(weatherServiceURL string, upstreams internals.UpstreamsConfig, trace trace.Tracer) *OtelWeatherInputHandler {
 	return &OtelWeatherInputHandler{
-		InternalService: services.NewInternalWeatherService(),
+		InternalService: services.NewInternalWeatherService(weatherServiceURL, upstreams),
 		OTELTracer:      trace,
 	}
 }
@@ -40,7 +42,7 @@ func (wh *OtelWeatherInputHandler) PostWeather(w http.ResponseWriter, r *http.Re
 	carrier := propagation.HeaderCarrier(r.Header)
 	ctx = otel.GetTextMapPropagator().Extract(ctx, carrier)
 
-	_, span := wh.OTELTracer.Start(ctx, "OtelWeatherInputHandler.PostWeather")
+	ctx, span := wh.OTELTracer.Start(ctx, "OtelWeatherInputHandler.PostWeather")
 	defer span.End()
 
 	var input PostOtelWeatherInput
@@ -59,20 +61,28 @@ func (wh *OtelWeatherInputHandler) PostWeather(w http.ResponseWriter, r *http.Re
 	}
 	response, error := wh.InternalService.GetWeather(ctx, zipCode)
 	if error != nil {
+		if errors.Is(error, services.ErrQuotaExhausted) {
+			logging.Logger.ErrorContext(ctx, services.ErrQuotaExhausted.Error(), "error", error)
+			writeQuotaExhausted(w, error)
+			return
+		}
 		var statusCode int
 		var message string
-		switch error {
-		case services.ErrCEPNotFound:
+		switch {
+		case errors.Is(error, internals.ErrCircuitOpen), error == services.ErrServiceUnavailable:
+			statusCode = http.StatusServiceUnavailable
+			message = "service unavailable"
+		case error == services.ErrCEPNotFound:
 			statusCode = http.StatusNotFound
 			message = "can not find zipcode"
-		case services.ErrInvalidCEP:
+		case error == services.ErrInvalidCEP:
 			statusCode = http.StatusUnprocessableEntity
 			message = "invalid zipcode"
 		default:
 			statusCode = http.StatusInternalServerError
 			message = "internal server error"
 		}
-		logging.Logger.ErrorContext(ctx, message, error)
+		logging.Logger.ErrorContext(ctx, message, "error", error)
 		w.WriteHeader(statusCode)
 		w.Write([]byte(message))
 		return
@@ -1,10 +1,17 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/rcbadiale/go_open_telemetry/internals"
+	"github.com/rcbadiale/go_open_telemetry/internals/config"
 	"github.com/rcbadiale/go_open_telemetry/internals/services"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/propagation"
@@ -21,17 +28,53 @@ type GetWeatherResponse struct {
 type WeatherHandler struct {
 	CEPService     services.CEPService
 	WeatherService services.WeatherService
+	WeatherAPIKeys *services.WeatherAPIKeyPool
 	Tracer         trace.Tracer
+	// stopWatching stops watching the secret files
+	stopWatching context.CancelFunc
 }
 
-func NewWeatherHandler(weatherApiKey string, tracer trace.Tracer) *WeatherHandler {
+func NewWeatherHandler(cfg *config.WeatherService, tracer trace.Tracer) *WeatherHandler {
+	weatherAPIKeys := services.NewWeatherAPIKeyPool(cfg.WeatherProviders.WeatherAPIKeys)
+	watchCtx, stopWatching := context.WithCancel(context.Background())
+	weatherAPIKeys.Watch(watchCtx)
 	return &WeatherHandler{
 		Tracer:         tracer,
-		CEPService:     services.NewViaCEPService(),
-		WeatherService: services.NewWeatherAPIService(weatherApiKey),
+		WeatherAPIKeys: weatherAPIKeys,
+		stopWatching:   stopWatching,
+		CEPService: services.NewCachedCEPService(
+			services.NewCEPService(cfg.CEPProviders, cfg.Upstreams),
+			services.NewCEPCacheStore(cfg.CEPCache),
+			cfg.CEPCache,
+		),
+		WeatherService: services.NewCachedWeatherService(
+			services.NewWeatherService(cfg.WeatherProviders, weatherAPIKeys, cfg.Upstreams),
+			cfg.WeatherCache,
+		),
 	}
 }
 
+// Reload reads the secret files again, such as the WeatherAPI keys
+func (wh *WeatherHandler) Reload(ctx context.Context) error {
+	return wh.WeatherAPIKeys.Reload(ctx)
+}
+
+// Close releases the resources held by the services, such as the CEP cache
+// and the quota files
+func (wh *WeatherHandler) Close() error {
+	if wh.stopWatching != nil {
+		wh.stopWatching()
+	}
+	var errs []error
+	if wh.WeatherAPIKeys != nil {
+		errs = append(errs, wh.WeatherAPIKeys.Close())
+	}
+	if closer, ok := wh.CEPService.(io.Closer); ok {
+		errs = append(errs, closer.Close())
+	}
+	return errors.Join(errs...)
+}
+
 // GetWeather returns the weather
 func (wh *WeatherHandler) GetWeather(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -47,6 +90,11 @@ func (wh *WeatherHandler) GetWeather(w http.ResponseWriter, r *http.Request) {
 	}
 	responseCEP, error := wh.CEPService.GetAddressByCEP(ctx, zipCode)
 	if error != nil {
+		if errors.Is(error, internals.ErrCircuitOpen) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("service unavailable"))
+			return
+		}
 		switch error {
 		case services.ErrCEPNotFound:
 			w.WriteHeader(http.StatusNotFound)
@@ -62,10 +110,24 @@ func (wh *WeatherHandler) GetWeather(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	}
-	responseWeather, error := wh.WeatherService.GetWeatherByCity(ctx, responseCEP.Localidade)
+	responseWeather, error := wh.WeatherService.GetWeather(ctx, services.WeatherLocationFromAddress(responseCEP))
 	if error != nil {
+		if errors.Is(error, services.ErrQuotaExhausted) {
+			writeQuotaExhausted(w, error)
+			return
+		}
+		if errors.Is(error, services.ErrNoWeatherAPIKey) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("service unavailable"))
+			return
+		}
+		if errors.Is(error, internals.ErrCircuitOpen) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("service unavailable"))
+			return
+		}
 		switch error {
-		case services.ErrCEPNotFound:
+		case services.ErrCEPNotFound, services.ErrLocationNotFound, services.ErrLocationMismatch:
 			w.WriteHeader(http.StatusNotFound)
 			w.Write([]byte("can not find zipcode"))
 			return
@@ -81,7 +143,7 @@ func (wh *WeatherHandler) GetWeather(w http.ResponseWriter, r *http.Request) {
 	}
 	// Truncating values to ensure only 1 decimal place
 	output := GetWeatherResponse{
-		City:  responseCEP.Localidade,
+		City:  responseCEP.City,
 		TempC: float64(int(responseWeather.Current.TempC*10)) / 10,
 		TempF: float64(int(responseWeather.Current.TempF*10)) / 10,
 		TempK: float64(int((responseWeather.Current.TempC+273.15)*10)) / 10,
@@ -90,3 +152,22 @@ func (wh *WeatherHandler) GetWeather(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(output)
 }
+
+// GetWeatherAPIKeys returns the health of the WeatherAPI keys, without their
+// values
+func (wh *WeatherHandler) GetWeatherAPIKeys(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(wh.WeatherAPIKeys.Health())
+}
+
+// writeQuotaExhausted answers 503 quota_exhausted with the Retry-After of the
+// budget that ran out, when known
+func writeQuotaExhausted(w http.ResponseWriter, err error) {
+	var quotaErr *services.QuotaExhaustedError
+	if errors.As(err, &quotaErr) && quotaErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(quotaErr.RetryAfter.Seconds()))))
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+	w.Write([]byte(services.ErrQuotaExhausted.Error()))
+}
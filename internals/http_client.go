@@ -0,0 +1,241 @@
+package internals
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"golang.org/x/net/http/httpproxy"
+)
+
+// HTTPClientConfig configures the client calling an upstream.
+type HTTPClientConfig struct {
+	// Upstream is the name of the upstream called, used on the logs.
+	Upstream string
+	// DialTimeout bounds establishing the TCP connection.
+	DialTimeout time.Duration
+	// TLSHandshakeTimeout bounds the TLS handshake.
+	TLSHandshakeTimeout time.Duration
+	// ResponseHeaderTimeout bounds the wait for the response headers once
+	// the request is sent.
+	ResponseHeaderTimeout time.Duration
+	// Timeout bounds a whole request, including reading the body.
+	Timeout time.Duration
+	// MaxIdleConnsPerHost is the amount of idle connections kept open.
+	MaxIdleConnsPerHost int
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout time.Duration
+	// HTTP2 prefers HTTP/2 when the upstream supports it.
+	HTTP2 bool
+	// Proxy overrides the proxy set by HTTPS_PROXY, HTTP_PROXY and NO_PROXY.
+	// "direct" disables the proxy, empty uses the environment. It is masked
+	// when printed as it may carry credentials.
+	Proxy string `secret:"true"`
+	// HTTPSProxy, HTTPProxy and NoProxy are the HTTPS_PROXY, HTTP_PROXY and
+	// NO_PROXY settings (or their lower case names) used when Proxy is empty.
+	HTTPSProxy string `secret:"true"`
+	HTTPProxy  string `secret:"true"`
+	NoProxy    string
+	// CAFile is a PEM bundle trusted on top of the system certificates, e.g.
+	// the CA of an egress proxy.
+	CAFile string
+}
+
+// ProxyDirect disables the proxy of an upstream
+const ProxyDirect = "direct"
+
+// HTTPClientConfigFromEnv reads the client settings of an upstream from
+// HTTP_CLIENT_DIAL_TIMEOUT, HTTP_CLIENT_TLS_HANDSHAKE_TIMEOUT,
+// HTTP_CLIENT_RESPONSE_HEADER_TIMEOUT, HTTP_CLIENT_TIMEOUT,
+// HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST, HTTP_CLIENT_IDLE_CONN_TIMEOUT,
+// HTTP_CLIENT_HTTP2, HTTP_CLIENT_PROXY and HTTP_CLIENT_CA_FILE. Each of them
+// can be overridden for a single upstream, e.g. HTTP_CLIENT_WEATHERAPI_TIMEOUT.
+// The proxy of the environment is read from HTTPS_PROXY, HTTP_PROXY and
+// NO_PROXY.
+func HTTPClientConfigFromEnv(env environment.Source, upstream string) HTTPClientConfig {
+	prefix := "HTTP_CLIENT_" + upstreamEnvName(upstream) + "_"
+	duration := func(name string, fallback time.Duration) time.Duration {
+		return env.GetDurationOrDefault(prefix+name, env.GetDurationOrDefault("HTTP_CLIENT_"+name, fallback))
+	}
+	return HTTPClientConfig{
+		Upstream:              upstream,
+		DialTimeout:           duration("DIAL_TIMEOUT", 5*time.Second),
+		TLSHandshakeTimeout:   duration("TLS_HANDSHAKE_TIMEOUT", 5*time.Second),
+		ResponseHeaderTimeout: duration("RESPONSE_HEADER_TIMEOUT", 5*time.Second),
+		Timeout:               duration("TIMEOUT", 8*time.Second),
+		MaxIdleConnsPerHost:   env.GetIntOrDefault(prefix+"MAX_IDLE_CONNS_PER_HOST", env.GetIntOrDefault("HTTP_CLIENT_MAX_IDLE_CONNS_PER_HOST", 10)),
+		IdleConnTimeout:       duration("IDLE_CONN_TIMEOUT", 90*time.Second),
+		HTTP2:                 env.GetBoolOrDefault(prefix+"HTTP2", env.GetBoolOrDefault("HTTP_CLIENT_HTTP2", true)),
+		Proxy:                 env.GetEnvOrDefault(prefix+"PROXY", env.GetEnvOrDefault("HTTP_CLIENT_PROXY", "")),
+		HTTPSProxy:            getEnvAnyCase(env, "HTTPS_PROXY"),
+		HTTPProxy:             getEnvAnyCase(env, "HTTP_PROXY"),
+		NoProxy:               getEnvAnyCase(env, "NO_PROXY"),
+		CAFile:                env.GetEnvOrDefault(prefix+"CA_FILE", env.GetEnvOrDefault("HTTP_CLIENT_CA_FILE", "")),
+	}
+}
+
+// upstreamEnvName formats an upstream name for the environment variables,
+// e.g. "weather-service" becomes "WEATHER_SERVICE".
+func upstreamEnvName(upstream string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(upstream))
+}
+
+// Validate checks the settings, returning all the invalid ones. The proxy
+// and the CA bundle are checked as they are used, so a typo does not fall
+// back to a direct connection or to the system certificates.
+func (c HTTPClientConfig) Validate() error {
+	prefix := "HTTP_CLIENT_" + upstreamEnvName(c.Upstream) + "_"
+	var errs []error
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"DIAL_TIMEOUT", c.DialTimeout},
+		{"TLS_HANDSHAKE_TIMEOUT", c.TLSHandshakeTimeout},
+		{"RESPONSE_HEADER_TIMEOUT", c.ResponseHeaderTimeout},
+		{"TIMEOUT", c.Timeout},
+		{"IDLE_CONN_TIMEOUT", c.IdleConnTimeout},
+	} {
+		if timeout.value < 0 {
+			errs = append(errs, fmt.Errorf("%s%s can not be negative", prefix, timeout.name))
+		}
+	}
+	if c.MaxIdleConnsPerHost < 0 {
+		errs = append(errs, fmt.Errorf("%sMAX_IDLE_CONNS_PER_HOST can not be negative", prefix))
+	}
+	if _, err := newProxyFunc(c); err != nil {
+		errs = append(errs, fmt.Errorf("%sPROXY: %w", prefix, err))
+	}
+	if _, err := newTLSConfig(c); err != nil {
+		errs = append(errs, fmt.Errorf("%sCA_FILE: %w", prefix, err))
+	}
+	return errors.Join(errs...)
+}
+
+// NewHTTPClient creates an instrumented client, every request to the
+// upstream is traced by otelhttp. Invalid proxy or CA settings are returned
+// as errors.
+func NewHTTPClient(config HTTPClientConfig) (*http.Client, error) {
+	proxy, err := newProxyFunc(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid proxy of %s: %w", config.Upstream, err)
+	}
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CA bundle of %s: %w", config.Upstream, err)
+	}
+	dialer := &net.Dialer{
+		Timeout:   config.DialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+	transport := &http.Transport{
+		Proxy:                 proxy,
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   config.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: config.ResponseHeaderTimeout,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   config.MaxIdleConnsPerHost,
+		IdleConnTimeout:       config.IdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     config.HTTP2,
+	}
+	logOutboundConfig(config)
+	return &http.Client{
+		Transport: otelhttp.NewTransport(transport),
+		Timeout:   config.Timeout,
+	}, nil
+}
+
+// newProxyFunc returns the proxy of the upstream, falling back to
+// HTTPS_PROXY, HTTP_PROXY and NO_PROXY
+func newProxyFunc(config HTTPClientConfig) (func(*http.Request) (*url.URL, error), error) {
+	switch config.Proxy {
+	case "":
+		proxy := (&httpproxy.Config{HTTPSProxy: config.HTTPSProxy, HTTPProxy: config.HTTPProxy, NoProxy: config.NoProxy}).ProxyFunc()
+		return func(req *http.Request) (*url.URL, error) { return proxy(req.URL) }, nil
+	case ProxyDirect:
+		return nil, nil
+	}
+	proxyURL, err := url.Parse(config.Proxy)
+	if err != nil {
+		// The parse error includes the URL, which may hold credentials
+		return nil, errors.New("invalid proxy URL")
+	}
+	switch {
+	case proxyURL.Host == "":
+		return nil, fmt.Errorf("proxy URL %q has no host", redactProxy(config.Proxy))
+	case proxyURL.Scheme != "http" && proxyURL.Scheme != "https" && proxyURL.Scheme != "socks5":
+		return nil, fmt.Errorf("proxy URL %q must use http, https or socks5", redactProxy(config.Proxy))
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// newTLSConfig trusts the CA bundle on top of the system certificates, a nil
+// config uses the system certificates only
+func newTLSConfig(config HTTPClientConfig) (*tls.Config, error) {
+	if config.CAFile == "" {
+		return nil, nil
+	}
+	pem, err := os.ReadFile(config.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificate found in %s", config.CAFile)
+	}
+	return &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}, nil
+}
+
+// logOutboundConfig logs the effective settings of the client, proxy
+// credentials are not logged
+func logOutboundConfig(config HTTPClientConfig) {
+	proxy := redactProxy(config.Proxy)
+	if config.Proxy == "" {
+		proxy = "environment"
+	}
+	logging.Logger.Info("Outbound HTTP client configured",
+		"upstream", config.Upstream,
+		"proxy", proxy,
+		"https_proxy", redactProxy(config.HTTPSProxy),
+		"http_proxy", redactProxy(config.HTTPProxy),
+		"no_proxy", config.NoProxy,
+		"ca_file", config.CAFile,
+		"dial_timeout", config.DialTimeout.String(),
+		"tls_handshake_timeout", config.TLSHandshakeTimeout.String(),
+		"response_header_timeout", config.ResponseHeaderTimeout.String(),
+		"timeout", config.Timeout.String(),
+		"max_idle_conns_per_host", config.MaxIdleConnsPerHost,
+		"http2", config.HTTP2,
+	)
+}
+
+// redactProxy hides the password of a proxy URL. A URL that can not be
+// parsed is replaced as a whole, as the password can not be told apart.
+func redactProxy(proxy string) string {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil {
+		return "<invalid>"
+	}
+	return proxyURL.Redacted()
+}
+
+// getEnvAnyCase reads a setting in upper or lower case, as the proxy ones are
+// commonly set in both
+func getEnvAnyCase(env environment.Source, key string) string {
+	return env.GetEnvOrDefault(key, env.GetEnvOrDefault(strings.ToLower(key), ""))
+}
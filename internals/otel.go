@@ -1,53 +0,0 @@
-package internals
-
-import (
-	"context"
-	"log"
-
-	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
-	"go.opentelemetry.io/otel"
-	stdout "go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
-	"go.opentelemetry.io/otel/propagation"
-	"go.opentelemetry.io/otel/sdk/resource"
-	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
-	oteltrace "go.opentelemetry.io/otel/trace"
-)
-
-// setupOTelSDK bootstraps the OpenTelemetry pipeline.
-// If it does not return an error, make sure to call shutdown for proper cleanup.
-func SetupOTelSDK(serverName string) oteltrace.Tracer {
-	tp := initTracerProvider(serverName)
-	defer func() {
-		if err := tp.Shutdown(context.Background()); err != nil {
-			logging.Logger.Error("Error shutting down tracer provider: %v", err)
-		}
-	}()
-	// This sets the global TracerProvider
-	otel.SetTracerProvider(tp)
-	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
-	return otel.Tracer(serverName)
-}
-
-func initTracerProvider(serverName string) *sdktrace.TracerProvider {
-	exporter, err := stdout.New(stdout.WithPrettyPrint())
-	if err != nil {
-		log.Fatal(err)
-	}
-	res, err := resource.New(
-		context.Background(),
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceNameKey.String(serverName),
-		),
-	)
-	if err != nil {
-		logging.Logger.Error("unable to initialize resource due: %v", err)
-		panic(err)
-	}
-	return sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithBatcher(exporter),
-		sdktrace.WithResource(res),
-	)
-}
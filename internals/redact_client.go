@@ -0,0 +1,24 @@
+package internals
+
+import (
+	"net/http"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/redact"
+)
+
+// RedactClient redacts the secrets, such as API keys, from the URL included
+// in the errors returned by http.Client, so they never reach the logs nor the
+// span statuses.
+type RedactClient struct {
+	next HTTPClient
+}
+
+// NewRedactClient creates a RedactClient decorating next
+func NewRedactClient(next HTTPClient) HTTPClient {
+	return &RedactClient{next: next}
+}
+
+func (c *RedactClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.Do(req)
+	return resp, redact.Error(err)
+}
@@ -0,0 +1,179 @@
+package internals
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RetryConfig configures the RetryClient.
+type RetryConfig struct {
+	// MaxAttempts is the maximum amount of attempts, including the first one.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry, doubled on every
+	// retry up to MaxBackoff. A random jitter is applied to every wait.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Budget bounds the time spent on all the attempts of a request, no
+	// retry is made when it would end after the budget or the request
+	// deadline.
+	Budget time.Duration
+}
+
+// RetryConfigFromEnv reads the retry settings from HTTP_RETRY_MAX_ATTEMPTS,
+// HTTP_RETRY_INITIAL_BACKOFF, HTTP_RETRY_MAX_BACKOFF and HTTP_RETRY_BUDGET.
+func RetryConfigFromEnv(env environment.Source) RetryConfig {
+	return RetryConfig{
+		MaxAttempts:    env.GetIntOrDefault("HTTP_RETRY_MAX_ATTEMPTS", 3),
+		InitialBackoff: env.GetDurationOrDefault("HTTP_RETRY_INITIAL_BACKOFF", 100*time.Millisecond),
+		MaxBackoff:     env.GetDurationOrDefault("HTTP_RETRY_MAX_BACKOFF", 2*time.Second),
+		Budget:         env.GetDurationOrDefault("HTTP_RETRY_BUDGET", 5*time.Second),
+	}
+}
+
+// RetryClient retries idempotent requests failing with connection errors,
+// 429 or 5xx, waiting an exponential backoff with jitter or the Retry-After
+// sent by the upstream between the attempts. Refused requests, see
+// ErrRefused, are not retried.
+type RetryClient struct {
+	next   HTTPClient
+	config RetryConfig
+}
+
+// NewRetryClient creates a RetryClient decorating next
+func NewRetryClient(next HTTPClient, config RetryConfig) HTTPClient {
+	return &RetryClient{next: next, config: config}
+}
+
+func (c *RetryClient) Do(req *http.Request) (*http.Response, error) {
+	if !c.retryable(req) {
+		return c.next.Do(req)
+	}
+	ctx := req.Context()
+	span := trace.SpanFromContext(ctx)
+	deadline := time.Now().Add(c.config.Budget)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := c.next.Do(req)
+		attributes := []attribute.KeyValue{attribute.Int("http.request.attempt", attempt)}
+		if err != nil {
+			attributes = append(attributes, attribute.String("error", err.Error()))
+		} else {
+			attributes = append(attributes, attribute.Int("http.response.status_code", resp.StatusCode))
+		}
+		span.AddEvent("Upstream request attempt", trace.WithAttributes(attributes...))
+
+		if attempt >= c.config.MaxAttempts || !shouldRetry(resp, err) {
+			return resp, err
+		}
+		wait := c.backoff(attempt)
+		if retryAfter, ok := ParseRetryAfter(resp); ok {
+			wait = retryAfter
+		}
+		if time.Now().Add(wait).After(deadline) {
+			return resp, err
+		}
+		if resp != nil {
+			// Drains the body so the connection can be reused
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		if req.GetBody != nil {
+			if req.Body, err = req.GetBody(); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// retryable reports whether the request is idempotent and can be sent again
+func (c *RetryClient) retryable(req *http.Request) bool {
+	if c.config.MaxAttempts <= 1 {
+		return false
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return false
+	}
+	return req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+}
+
+// backoff returns the wait before the next attempt, a random duration up to
+// the exponential backoff (full jitter).
+func (c *RetryClient) backoff(attempt int) time.Duration {
+	backoff := c.config.MaxBackoff
+	if shift := attempt - 1; shift < 32 {
+		if exponential := c.config.InitialBackoff << shift; exponential > 0 && exponential < backoff {
+			backoff = exponential
+		}
+	}
+	if backoff <= 0 {
+		return 0
+	}
+	return rand.N(backoff)
+}
+
+// shouldRetry reports whether the attempt failed with a transient error
+func shouldRetry(resp *http.Response, err error) bool {
+	if refused(err) {
+		return false
+	}
+	if err != nil {
+		// The request was canceled or its deadline exceeded, retrying would
+		// fail the same way
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+}
+
+// ParseRetryAfter reads the Retry-After header, either in seconds or as an
+// HTTP date
+func ParseRetryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c RetryConfig) Validate() error {
+	var errs []error
+	if c.MaxAttempts < 1 {
+		errs = append(errs, errors.New("HTTP_RETRY_MAX_ATTEMPTS must be at least 1"))
+	}
+	if c.InitialBackoff < 0 || c.MaxBackoff < 0 {
+		errs = append(errs, errors.New("HTTP_RETRY_INITIAL_BACKOFF and HTTP_RETRY_MAX_BACKOFF can not be negative"))
+	}
+	if c.Budget <= 0 {
+		errs = append(errs, errors.New("HTTP_RETRY_BUDGET must be positive"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// MetricsMiddleware records the request count and latency (RED metrics) for
+// every request served by the router.
+func MetricsMiddleware(serviceName string) func(http.Handler) http.Handler {
+	meter := otel.Meter(serviceName)
+	requests, err := meter.Int64Counter(
+		"http.server.requests",
+		metric.WithDescription("Number of HTTP requests received"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	duration, err := meter.Float64Histogram(
+		"http.server.duration",
+		metric.WithDescription("Duration of the HTTP requests"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r)
+
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := r.URL.Path
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				route = rctx.RoutePattern()
+			}
+			attrs := metric.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.route", route),
+				attribute.Int("http.status_code", status),
+			)
+			requests.Add(r.Context(), 1, attrs)
+			duration.Record(r.Context(), time.Since(start).Seconds(), attrs)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
+
+const (
+	AwesomeAPICEP_URL = "https://cep.awesomeapi.com.br/json/%s"
+)
+
+// AwesomeAPICEPService is a service to interact with the AwesomeAPI CEP API
+type AwesomeAPICEPService struct {
+	BaseHttpService
+	URL string
+}
+
+type AwesomeAPICEPResponse struct {
+	Cep         string `json:"cep"`
+	AddressType string `json:"address_type"`
+	AddressName string `json:"address_name"`
+	Address     string `json:"address"`
+	State       string `json:"state"`
+	District    string `json:"district"`
+	Lat         string `json:"lat"`
+	Lng         string `json:"lng"`
+	City        string `json:"city"`
+	CityIbge    string `json:"city_ibge"`
+	Ddd         string `json:"ddd"`
+}
+
+// NewAwesomeAPICEPService creates a new AwesomeAPICEPService
+func NewAwesomeAPICEPService(upstreams internals.UpstreamsConfig) CEPService {
+	return &AwesomeAPICEPService{
+		BaseHttpService: newBaseHttpService(CEPProviderAwesomeAPI, upstreams),
+		URL:             AwesomeAPICEP_URL,
+	}
+}
+
+// GetAddressByCEP returns the address for a given CEP
+func (a *AwesomeAPICEPService) GetAddressByCEP(ctx context.Context, cep string) (*Address, error) {
+	ctx, span := a.Tracer.Start(ctx, "AwesomeAPICEPService.GetAddressByCEP")
+	defer span.End()
+
+	var response AwesomeAPICEPResponse
+	statusCode, err := a.getJSON(ctx, fmt.Sprintf(a.URL, cep), &response)
+	if err != nil {
+		return nil, err
+	}
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrCEPNotFound
+	case http.StatusBadRequest:
+		return nil, ErrInvalidCEP
+	default:
+		return nil, fmt.Errorf("error getting address from awesomeapi: %d", statusCode)
+	}
+
+	return &Address{
+		CEP:          response.Cep,
+		Street:       response.Address,
+		Neighborhood: response.District,
+		City:         response.City,
+		State:        response.State,
+		Latitude:     parseCoordinate(response.Lat),
+		Longitude:    parseCoordinate(response.Lng),
+		Provider:     CEPProviderAwesomeAPI,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
+
+const (
+	BrasilAPI_URL = "https://brasilapi.com.br/api/cep/v2/%s"
+)
+
+// BrasilAPIService is a service to interact with the BrasilAPI CEP API
+type BrasilAPIService struct {
+	BaseHttpService
+	URL string
+}
+
+type BrasilAPIResponse struct {
+	Cep          string `json:"cep"`
+	State        string `json:"state"`
+	City         string `json:"city"`
+	Neighborhood string `json:"neighborhood"`
+	Street       string `json:"street"`
+	Service      string `json:"service"`
+	Location     struct {
+		Type        string `json:"type"`
+		Coordinates struct {
+			Longitude string `json:"longitude"`
+			Latitude  string `json:"latitude"`
+		} `json:"coordinates"`
+	} `json:"location"`
+}
+
+// NewBrasilAPIService creates a new BrasilAPIService
+func NewBrasilAPIService(upstreams internals.UpstreamsConfig) CEPService {
+	return &BrasilAPIService{
+		BaseHttpService: newBaseHttpService(CEPProviderBrasilAPI, upstreams),
+		URL:             BrasilAPI_URL,
+	}
+}
+
+// GetAddressByCEP returns the address for a given CEP
+func (b *BrasilAPIService) GetAddressByCEP(ctx context.Context, cep string) (*Address, error) {
+	ctx, span := b.Tracer.Start(ctx, "BrasilAPIService.GetAddressByCEP")
+	defer span.End()
+
+	var response BrasilAPIResponse
+	statusCode, err := b.getJSON(ctx, fmt.Sprintf(b.URL, cep), &response)
+	if err != nil {
+		return nil, err
+	}
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrCEPNotFound
+	case http.StatusBadRequest:
+		return nil, ErrInvalidCEP
+	default:
+		return nil, fmt.Errorf("error getting address from brasilapi: %d", statusCode)
+	}
+
+	return &Address{
+		CEP:          response.Cep,
+		Street:       response.Street,
+		Neighborhood: response.Neighborhood,
+		City:         response.City,
+		State:        response.State,
+		Latitude:     parseCoordinate(response.Location.Coordinates.Latitude),
+		Longitude:    parseCoordinate(response.Location.Coordinates.Longitude),
+		Provider:     CEPProviderBrasilAPI,
+	}, nil
+}
+
+// parseCoordinate parses the coordinates returned as strings by the CEP
+// providers, which may be missing.
+func parseCoordinate(value string) *float64 {
+	coordinate, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil
+	}
+	return &coordinate
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// newCacheRequestsCounter creates the counter of cache lookups shared by the
+// caching services.
+func newCacheRequestsCounter() metric.Int64Counter {
+	requests, err := otel.Meter("").Int64Counter(
+		"cache.requests",
+		metric.WithDescription("Number of cache lookups by result"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	return requests
+}
+
+// recordCacheRequest records a lookup on the named cache, result being hit,
+// miss or any other cache specific outcome.
+func recordCacheRequest(ctx context.Context, requests metric.Int64Counter, cacheName, result string) {
+	if requests == nil {
+		return
+	}
+	requests.Add(ctx, 1, metric.WithAttributes(
+		attribute.String("cache", cacheName),
+		attribute.String("result", result),
+	))
+}
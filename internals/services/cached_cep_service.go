@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/cache"
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Backends available to store the CEP cache.
+const (
+	CacheBackendMemory = "memory"
+	CacheBackendBolt   = "bolt"
+)
+
+// CEPCacheConfig configures the CachedCEPService.
+type CEPCacheConfig struct {
+	// Backend is where the cache is stored, memory or bolt (on disk).
+	Backend string
+	// Size is the maximum amount of CEPs kept, in memory or in the bolt file.
+	Size int
+	// Path is the bolt cache file.
+	Path string
+	// CompactionInterval is how often expired entries are removed from the
+	// bolt cache file and the file is rewritten to release their space.
+	CompactionInterval time.Duration
+	// TTL is how long a found address is kept.
+	TTL time.Duration
+	// NegativeTTL is how long a CEP not found is kept.
+	NegativeTTL time.Duration
+}
+
+// CEPCacheConfigFromEnv reads the CEP cache settings from CEP_CACHE_BACKEND,
+// CEP_CACHE_SIZE, CEP_CACHE_PATH, CEP_CACHE_COMPACTION_INTERVAL,
+// CEP_CACHE_TTL and CEP_CACHE_NEGATIVE_TTL.
+func CEPCacheConfigFromEnv(env environment.Source) CEPCacheConfig {
+	return CEPCacheConfig{
+		Backend:            env.GetEnvOrDefault("CEP_CACHE_BACKEND", CacheBackendMemory),
+		Size:               env.GetIntOrDefault("CEP_CACHE_SIZE", 10000),
+		Path:               env.GetEnvOrDefault("CEP_CACHE_PATH", "cep-cache.db"),
+		CompactionInterval: env.GetDurationOrDefault("CEP_CACHE_COMPACTION_INTERVAL", 10*time.Minute),
+		TTL:                env.GetDurationOrDefault("CEP_CACHE_TTL", 24*time.Hour),
+		NegativeTTL:        env.GetDurationOrDefault("CEP_CACHE_NEGATIVE_TTL", time.Hour),
+	}
+}
+
+// NewCEPCacheStore creates the store for the configured backend, falling back
+// to memory when the bolt cache file can not be opened.
+func NewCEPCacheStore(config CEPCacheConfig) cache.Store {
+	if config.Backend == CacheBackendBolt {
+		store, err := cache.NewBoltStore(config.Path, config.Size, config.CompactionInterval)
+		if err == nil {
+			return store
+		}
+		logging.Logger.Error("Error opening CEP cache file, using memory", "path", config.Path, "error", err)
+	} else if config.Backend != CacheBackendMemory {
+		logging.Logger.Error("Unknown CEP cache backend, using memory", "backend", config.Backend)
+	}
+	return cache.NewMemoryStore(config.Size)
+}
+
+// CachedCEPService caches the addresses returned by another CEPService,
+// including the CEPs not found.
+type CachedCEPService struct {
+	next     CEPService
+	config   CEPCacheConfig
+	store    cache.Store
+	tracer   trace.Tracer
+	requests metric.Int64Counter
+}
+
+type cepCacheEntry struct {
+	Address  *Address `json:"address,omitempty"`
+	NotFound bool     `json:"not_found,omitempty"`
+}
+
+// cepCacheKey prefixes the CEP with the entry model, so the persisted entries
+// of older models are not read and are left to expire.
+func cepCacheKey(cep string) string {
+	return "address:" + cep
+}
+
+// NewCachedCEPService creates a CachedCEPService decorating next
+func NewCachedCEPService(next CEPService, store cache.Store, config CEPCacheConfig) *CachedCEPService {
+	return &CachedCEPService{
+		next:     next,
+		config:   config,
+		store:    store,
+		tracer:   otel.Tracer(""),
+		requests: newCacheRequestsCounter(),
+	}
+}
+
+// GetAddressByCEP returns the cached address for a given CEP, calling the
+// decorated service on a cache miss
+func (c *CachedCEPService) GetAddressByCEP(ctx context.Context, cep string) (*Address, error) {
+	ctx, span := c.tracer.Start(ctx, "CachedCEPService.GetAddressByCEP")
+	defer span.End()
+
+	if entry, ok := c.get(ctx, cep); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		if entry.NotFound {
+			c.record(ctx, "negative_hit")
+			return nil, ErrCEPNotFound
+		}
+		c.record(ctx, "hit")
+		return entry.Address, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+	c.record(ctx, "miss")
+
+	address, err := c.next.GetAddressByCEP(ctx, cep)
+	switch {
+	// Only a plain not found is cached, an error joining it with a timeout
+	// or an outage of another provider may not hold on the next call
+	case err == ErrCEPNotFound:
+		c.set(ctx, cep, cepCacheEntry{NotFound: true}, c.config.NegativeTTL)
+	case err == nil:
+		c.set(ctx, cep, cepCacheEntry{Address: address}, c.config.TTL)
+	}
+	return address, err
+}
+
+// Close releases the cache store.
+func (c *CachedCEPService) Close() error {
+	return c.store.Close()
+}
+
+// get reads an entry from the store, failures are handled as a cache miss.
+func (c *CachedCEPService) get(ctx context.Context, cep string) (cepCacheEntry, bool) {
+	var entry cepCacheEntry
+	data, ok, err := c.store.Get(cepCacheKey(cep))
+	if err == nil && ok {
+		err = json.Unmarshal(data, &entry)
+	}
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "Error reading CEP cache", "error", err)
+		return entry, false
+	}
+	return entry, ok
+}
+
+func (c *CachedCEPService) set(ctx context.Context, cep string, entry cepCacheEntry, ttl time.Duration) {
+	data, err := json.Marshal(entry)
+	if err == nil {
+		err = c.store.Set(cepCacheKey(cep), data, ttl)
+	}
+	if err != nil {
+		logging.Logger.WarnContext(ctx, "Error writing CEP cache", "error", err)
+	}
+}
+
+func (c *CachedCEPService) record(ctx context.Context, result string) {
+	recordCacheRequest(ctx, c.requests, "cep", result)
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c CEPCacheConfig) Validate() error {
+	var errs []error
+	if c.Size <= 0 {
+		errs = append(errs, errors.New("CEP_CACHE_SIZE must be positive"))
+	}
+	switch c.Backend {
+	case CacheBackendMemory:
+	case CacheBackendBolt:
+		if c.Path == "" {
+			errs = append(errs, errors.New("CEP_CACHE_PATH is required by the bolt backend"))
+		}
+		if c.CompactionInterval <= 0 {
+			errs = append(errs, errors.New("CEP_CACHE_COMPACTION_INTERVAL must be positive"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("CEP_CACHE_BACKEND must be %s or %s, got %q", CacheBackendMemory, CacheBackendBolt, c.Backend))
+	}
+	if c.TTL <= 0 {
+		errs = append(errs, errors.New("CEP_CACHE_TTL must be positive"))
+	}
+	if c.NegativeTTL < 0 {
+		errs = append(errs, errors.New("CEP_CACHE_NEGATIVE_TTL can not be negative"))
+	}
+	return errors.Join(errs...)
+}
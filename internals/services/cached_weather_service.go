@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/cache"
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// WeatherCacheConfig configures the CachedWeatherService.
+type WeatherCacheConfig struct {
+	// Size is the maximum amount of locations kept in memory.
+	Size int
+	// TTL is how long a weather is fresh, counted from the time WeatherAPI
+	// last updated it (last_updated_epoch).
+	TTL time.Duration
+	// MinTTL is the minimum time a weather is fresh after being fetched,
+	// used when WeatherAPI data is already older than TTL.
+	MinTTL time.Duration
+	// StaleTTL is how long an expired weather is still served while it is
+	// refreshed in background.
+	StaleTTL time.Duration
+	// RefreshTimeout bounds the fetches shared by concurrent requests and the
+	// background refreshes.
+	RefreshTimeout time.Duration
+}
+
+// WeatherCacheConfigFromEnv reads the weather cache settings from
+// WEATHER_CACHE_SIZE, WEATHER_CACHE_TTL, WEATHER_CACHE_MIN_TTL,
+// WEATHER_CACHE_STALE_TTL and WEATHER_CACHE_REFRESH_TIMEOUT.
+func WeatherCacheConfigFromEnv(env environment.Source) WeatherCacheConfig {
+	return WeatherCacheConfig{
+		Size:           env.GetIntOrDefault("WEATHER_CACHE_SIZE", 5000),
+		TTL:            env.GetDurationOrDefault("WEATHER_CACHE_TTL", 15*time.Minute),
+		MinTTL:         env.GetDurationOrDefault("WEATHER_CACHE_MIN_TTL", time.Minute),
+		StaleTTL:       env.GetDurationOrDefault("WEATHER_CACHE_STALE_TTL", 10*time.Minute),
+		RefreshTimeout: env.GetDurationOrDefault("WEATHER_CACHE_REFRESH_TIMEOUT", 5*time.Second),
+	}
+}
+
+// CachedWeatherService caches the weather returned by another WeatherService
+// by normalized location. Concurrent misses for the same location result in a
+// single upstream call, and expired entries are served while refreshed in
+// background (stale-while-revalidate).
+type CachedWeatherService struct {
+	next     WeatherService
+	config   WeatherCacheConfig
+	cache    *cache.LRU[string, weatherCacheEntry]
+	group    singleflight.Group
+	tracer   trace.Tracer
+	requests metric.Int64Counter
+}
+
+type weatherCacheEntry struct {
+	weather    *WeatherAPIResponse
+	freshUntil time.Time
+}
+
+// NewCachedWeatherService creates a CachedWeatherService decorating next
+func NewCachedWeatherService(next WeatherService, config WeatherCacheConfig) WeatherService {
+	return &CachedWeatherService{
+		next:     next,
+		config:   config,
+		cache:    cache.NewLRU[string, weatherCacheEntry](config.Size),
+		tracer:   otel.Tracer(""),
+		requests: newCacheRequestsCounter(),
+	}
+}
+
+// GetWeather returns the cached weather for a given location, calling the
+// decorated service on a cache miss
+func (c *CachedWeatherService) GetWeather(ctx context.Context, location WeatherLocation) (*WeatherAPIResponse, error) {
+	ctx, span := c.tracer.Start(ctx, "CachedWeatherService.GetWeather")
+	defer span.End()
+
+	key := location.key()
+	if entry, ok := c.cache.Get(key); ok {
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+		if time.Now().Before(entry.freshUntil) {
+			c.record(ctx, "hit")
+			return entry.weather, nil
+		}
+		span.SetAttributes(attribute.Bool("cache.stale", true))
+		c.record(ctx, "stale")
+		c.refresh(ctx, key, location)
+		return entry.weather, nil
+	}
+	span.SetAttributes(attribute.Bool("cache.hit", false))
+	c.record(ctx, "miss")
+
+	// The fetch is shared by the concurrent requests, so it must not be
+	// canceled along with the request that started it
+	results := c.group.DoChan(key, func() (interface{}, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.config.RefreshTimeout)
+		defer cancel()
+		return c.fetch(fetchCtx, key, location)
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case result := <-results:
+		span.SetAttributes(attribute.Bool("cache.shared", result.Shared))
+		if result.Err != nil {
+			return nil, result.Err
+		}
+		return result.Val.(*WeatherAPIResponse), nil
+	}
+}
+
+// refresh updates an expired entry in background, the request being answered
+// does not wait for it.
+func (c *CachedWeatherService) refresh(ctx context.Context, key string, location WeatherLocation) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.config.RefreshTimeout)
+	go func() {
+		defer cancel()
+		_, err, _ := c.group.Do(key, func() (interface{}, error) {
+			return c.fetch(ctx, key, location)
+		})
+		if err != nil {
+			logging.Logger.WarnContext(ctx, "Error refreshing cached weather", "city", location.City, "state", location.State, "error", err)
+		}
+	}()
+}
+
+func (c *CachedWeatherService) fetch(ctx context.Context, key string, location WeatherLocation) (*WeatherAPIResponse, error) {
+	weather, err := c.next.GetWeather(ctx, location)
+	if err != nil {
+		return nil, err
+	}
+	freshUntil := c.freshUntil(weather)
+	c.cache.Set(key, weatherCacheEntry{weather: weather, freshUntil: freshUntil}, time.Until(freshUntil)+c.config.StaleTTL)
+	return weather, nil
+}
+
+// freshUntil aligns the expiration to the time WeatherAPI last updated the
+// weather, as it would not change before its next update.
+func (c *CachedWeatherService) freshUntil(weather *WeatherAPIResponse) time.Time {
+	now := time.Now()
+	minimum := now.Add(c.config.MinTTL)
+	if weather.Current.LastUpdatedEpoch == 0 {
+		return now.Add(c.config.TTL)
+	}
+	freshUntil := time.Unix(int64(weather.Current.LastUpdatedEpoch), 0).Add(c.config.TTL)
+	if freshUntil.Before(minimum) {
+		return minimum
+	}
+	return freshUntil
+}
+
+func (c *CachedWeatherService) record(ctx context.Context, result string) {
+	recordCacheRequest(ctx, c.requests, "weather", result)
+}
+
+// normalizeLocation builds a cache key insensitive to case, accents and extra
+// spaces, e.g. "São  Paulo" and "sao paulo" share the same key.
+func normalizeLocation(location string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	normalized, _, err := transform.String(t, location)
+	if err != nil {
+		normalized = location
+	}
+	return strings.Join(strings.Fields(strings.ToLower(normalized)), " ")
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c WeatherCacheConfig) Validate() error {
+	var errs []error
+	if c.Size <= 0 {
+		errs = append(errs, errors.New("WEATHER_CACHE_SIZE must be positive"))
+	}
+	if c.TTL <= 0 {
+		errs = append(errs, errors.New("WEATHER_CACHE_TTL must be positive"))
+	}
+	if c.MinTTL < 0 {
+		errs = append(errs, errors.New("WEATHER_CACHE_MIN_TTL can not be negative"))
+	}
+	if c.StaleTTL < 0 {
+		errs = append(errs, errors.New("WEATHER_CACHE_STALE_TTL can not be negative"))
+	}
+	if c.RefreshTimeout <= 0 {
+		errs = append(errs, errors.New("WEATHER_CACHE_REFRESH_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+)
+
+type CEPService interface {
+	GetAddressByCEP(ctx context.Context, cep string) (*Address, error)
+}
+
+// Address is the common address model returned by every CEPService
+type Address struct {
+	CEP          string `json:"cep"`
+	Street       string `json:"street"`
+	Neighborhood string `json:"neighborhood"`
+	City         string `json:"city"`
+	// State is the UF, e.g. "SP"
+	State string `json:"state"`
+	// Latitude and Longitude are only set by the providers returning them
+	Latitude  *float64 `json:"latitude,omitempty"`
+	Longitude *float64 `json:"longitude,omitempty"`
+	// Provider is the CEP provider which answered
+	Provider string `json:"provider"`
+}
+
+// CEP providers available to CEP_PROVIDERS
+const (
+	CEPProviderViaCEP     = "viacep"
+	CEPProviderBrasilAPI  = "brasilapi"
+	CEPProviderOpenCEP    = "opencep"
+	CEPProviderAwesomeAPI = "awesomeapi"
+)
+
+// CEPProvidersConfig configures which CEP providers are used and how.
+type CEPProvidersConfig struct {
+	// Providers are tried in this order.
+	Providers []string
+	// Mode is either FallbackModePriority or FallbackModeRace.
+	Mode string
+	// Timeout bounds each provider attempt.
+	Timeout time.Duration
+}
+
+// CEPProvidersConfigFromEnv reads the CEP providers settings from
+// CEP_PROVIDERS, CEP_PROVIDERS_MODE and CEP_PROVIDER_TIMEOUT.
+func CEPProvidersConfigFromEnv(env environment.Source) CEPProvidersConfig {
+	var providers []string
+	for _, provider := range strings.Split(env.GetEnvOrDefault("CEP_PROVIDERS", "viacep,brasilapi,opencep,awesomeapi"), ",") {
+		if provider = strings.ToLower(strings.TrimSpace(provider)); provider != "" {
+			providers = append(providers, provider)
+		}
+	}
+	return CEPProvidersConfig{
+		Providers: providers,
+		Mode:      env.GetEnvOrDefault("CEP_PROVIDERS_MODE", FallbackModePriority),
+		Timeout:   env.GetDurationOrDefault("CEP_PROVIDER_TIMEOUT", 3*time.Second),
+	}
+}
+
+// NewCEPService creates the CEPService querying the configured providers,
+// falling back between them when more than one is set.
+func NewCEPService(config CEPProvidersConfig, upstreams internals.UpstreamsConfig) CEPService {
+	var providers []NamedCEPService
+	for _, name := range config.Providers {
+		var provider CEPService
+		switch name {
+		case CEPProviderViaCEP:
+			provider = NewViaCEPService(upstreams)
+		case CEPProviderBrasilAPI:
+			provider = NewBrasilAPIService(upstreams)
+		case CEPProviderOpenCEP:
+			provider = NewOpenCEPService(upstreams)
+		case CEPProviderAwesomeAPI:
+			provider = NewAwesomeAPICEPService(upstreams)
+		default:
+			logging.Logger.Error("Unknown CEP provider, ignoring it", "provider", name)
+			continue
+		}
+		providers = append(providers, NamedCEPService{Name: name, CEPService: provider})
+	}
+	switch len(providers) {
+	case 0:
+		logging.Logger.Error("No valid CEP provider configured, using ViaCEP")
+		return NewViaCEPService(upstreams)
+	case 1:
+		return providers[0].CEPService
+	default:
+		return NewFallbackCEPService(providers, config.Mode, config.Timeout)
+	}
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c CEPProvidersConfig) Validate() error {
+	var errs []error
+	if len(c.Providers) == 0 {
+		errs = append(errs, errors.New("CEP_PROVIDERS must list at least one provider"))
+	}
+	for _, provider := range c.Providers {
+		switch provider {
+		case CEPProviderViaCEP, CEPProviderBrasilAPI, CEPProviderOpenCEP, CEPProviderAwesomeAPI:
+		default:
+			errs = append(errs, fmt.Errorf("CEP_PROVIDERS has an unknown provider %q", provider))
+		}
+	}
+	if c.Mode != FallbackModePriority && c.Mode != FallbackModeRace {
+		errs = append(errs, fmt.Errorf("CEP_PROVIDERS_MODE must be %s or %s, got %q", FallbackModePriority, FallbackModeRace, c.Mode))
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("CEP_PROVIDER_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Modes of the FallbackCEPService
+const (
+	// FallbackModePriority tries the providers one at a time, in order.
+	FallbackModePriority = "priority"
+	// FallbackModeRace queries every provider at once, the first address
+	// found wins.
+	FallbackModeRace = "race"
+)
+
+// NamedCEPService is a CEP provider used by the FallbackCEPService
+type NamedCEPService struct {
+	Name string
+	CEPService
+}
+
+// FallbackCEPService looks up the address in several CEP providers, so the
+// lookups keep working when one of them is down.
+type FallbackCEPService struct {
+	providers []NamedCEPService
+	mode      string
+	timeout   time.Duration
+	tracer    trace.Tracer
+}
+
+// NewFallbackCEPService creates a FallbackCEPService querying providers in the
+// given mode, each attempt bounded by timeout
+func NewFallbackCEPService(providers []NamedCEPService, mode string, timeout time.Duration) CEPService {
+	if mode != FallbackModeRace {
+		mode = FallbackModePriority
+	}
+	return &FallbackCEPService{
+		providers: providers,
+		mode:      mode,
+		timeout:   timeout,
+		tracer:    otel.Tracer(""),
+	}
+}
+
+// GetAddressByCEP returns the address found by the first provider answering.
+// ErrCEPNotFound is only returned when every provider agrees on it.
+func (f *FallbackCEPService) GetAddressByCEP(ctx context.Context, cep string) (*Address, error) {
+	ctx, span := f.tracer.Start(ctx, "FallbackCEPService.GetAddressByCEP", trace.WithAttributes(
+		attribute.String("cep.fallback_mode", f.mode),
+	))
+	defer span.End()
+
+	var address *Address
+	var err error
+	if f.mode == FallbackModeRace {
+		address, err = f.race(ctx, cep)
+	} else {
+		address, err = f.priority(ctx, cep)
+	}
+	if err != nil {
+		span.SetStatus(codes.Error, err.Error())
+		return nil, err
+	}
+	span.SetAttributes(attribute.String("cep.provider", address.Provider))
+	return address, nil
+}
+
+func (f *FallbackCEPService) priority(ctx context.Context, cep string) (*Address, error) {
+	errs := make([]error, 0, len(f.providers))
+	for i, provider := range f.providers {
+		address, err := f.attempt(ctx, ctx, i+1, provider, cep)
+		if err == nil {
+			return address, nil
+		} else if errors.Is(err, ErrInvalidCEP) {
+			return nil, ErrInvalidCEP
+		}
+		errs = append(errs, err)
+	}
+	return nil, combineProviderErrors(errs)
+}
+
+func (f *FallbackCEPService) race(parent context.Context, cep string) (*Address, error) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+
+	type result struct {
+		address *Address
+		err     error
+	}
+	results := make(chan result, len(f.providers))
+	for i, provider := range f.providers {
+		go func(attempt int, provider NamedCEPService) {
+			address, err := f.attempt(parent, ctx, attempt, provider, cep)
+			results <- result{address, err}
+		}(i+1, provider)
+	}
+
+	errs := make([]error, 0, len(f.providers))
+	for range f.providers {
+		r := <-results
+		if r.err == nil {
+			// Cancelling the context stops the remaining attempts
+			return r.address, nil
+		}
+		errs = append(errs, r.err)
+	}
+	return nil, combineProviderErrors(errs)
+}
+
+// attempt queries a single provider in its own span, bounded by the timeout.
+// ctx is derived from parent, cancelling it while parent is not done stops
+// an attempt that lost the race, which is not reported as a failure.
+func (f *FallbackCEPService) attempt(parent, ctx context.Context, attempt int, provider NamedCEPService, cep string) (*Address, error) {
+	ctx, span := f.tracer.Start(ctx, "FallbackCEPService.attempt", trace.WithAttributes(
+		attribute.String("cep.provider", provider.Name),
+		attribute.Int("cep.attempt", attempt),
+	))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	address, err := provider.GetAddressByCEP(ctx, cep)
+	if err != nil {
+		lost := errors.Is(err, context.Canceled) && parent.Err() == nil
+		if lost {
+			span.SetAttributes(attribute.Bool("cep.race_lost", true))
+		} else if !errors.Is(err, ErrCEPNotFound) && !errors.Is(err, ErrInvalidCEP) {
+			span.SetStatus(codes.Error, err.Error())
+			logging.Logger.WarnContext(ctx, "CEP provider failed", "provider", provider.Name, "error", err)
+		}
+		return nil, fmt.Errorf("%s: %w", provider.Name, err)
+	}
+	if address.Provider == "" {
+		address.Provider = provider.Name
+	}
+	return address, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// NamedWeatherService is a weather provider used by the FallbackWeatherService
+type NamedWeatherService struct {
+	Name string
+	WeatherService
+}
+
+// FallbackWeatherService queries the weather providers in order until one of
+// them answers, so the weather keeps working when a vendor is down or out of
+// quota.
+type FallbackWeatherService struct {
+	providers []NamedWeatherService
+	timeout   time.Duration
+	tracer    trace.Tracer
+}
+
+// NewFallbackWeatherService creates a FallbackWeatherService, each attempt
+// bounded by timeout
+func NewFallbackWeatherService(providers []NamedWeatherService, timeout time.Duration) WeatherService {
+	return &FallbackWeatherService{
+		providers: providers,
+		timeout:   timeout,
+		tracer:    otel.Tracer(""),
+	}
+}
+
+// GetWeather returns the weather from the first provider answering.
+// ErrLocationNotFound and ErrLocationMismatch are only returned when every
+// provider agrees on them.
+func (f *FallbackWeatherService) GetWeather(ctx context.Context, location WeatherLocation) (*WeatherAPIResponse, error) {
+	ctx, span := f.tracer.Start(ctx, "FallbackWeatherService.GetWeather")
+	defer span.End()
+
+	errs := make([]error, 0, len(f.providers))
+	for i, provider := range f.providers {
+		weather, err := f.attempt(ctx, i+1, provider, location)
+		if err == nil {
+			span.SetAttributes(attribute.String("weather.provider", provider.Name))
+			return weather, nil
+		}
+		errs = append(errs, err)
+	}
+	err := combineProviderErrors(errs)
+	span.SetStatus(codes.Error, err.Error())
+	return nil, err
+}
+
+// attempt queries a single provider in its own span, bounded by the timeout
+func (f *FallbackWeatherService) attempt(ctx context.Context, attempt int, provider NamedWeatherService, location WeatherLocation) (*WeatherAPIResponse, error) {
+	ctx, span := f.tracer.Start(ctx, "FallbackWeatherService.attempt", trace.WithAttributes(
+		attribute.String("weather.provider", provider.Name),
+		attribute.Int("weather.attempt", attempt),
+	))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, f.timeout)
+	defer cancel()
+
+	weather, err := provider.GetWeather(ctx, location)
+	if err != nil {
+		if !errors.Is(err, ErrLocationNotFound) && !errors.Is(err, ErrLocationMismatch) {
+			span.SetStatus(codes.Error, err.Error())
+			logging.Logger.WarnContext(ctx, "Weather provider failed", "provider", provider.Name, "error", err)
+		}
+		return nil, fmt.Errorf("%s: %w", provider.Name, err)
+	}
+	return weather, nil
+}
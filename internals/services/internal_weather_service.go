@@ -1,17 +1,17 @@
 package services
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
-	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/internals"
 	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
 )
 
 type InternalWeatherResponse struct {
@@ -30,8 +30,7 @@ type InternalWeatherAPIService struct {
 	ServiceUrl string
 }
 
-func (i *InternalWeatherAPIService) GetWeather(ctx context.Context, zipCode string) (*InternalWeatherResponse, error) {
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+func (i *InternalWeatherAPIService) GetWeather(ctx context.Context, zipCode string) (_ *InternalWeatherResponse, err error) {
 	ctx, span := i.Tracer.Start(ctx, "InternalWeatherAPIService.GetWeather")
 	defer span.End()
 	if len(zipCode) != 8 {
@@ -44,25 +43,30 @@ func (i *InternalWeatherAPIService) GetWeather(ctx context.Context, zipCode stri
 		nil,
 	)
 	if err != nil {
-		logging.Logger.Error("Error getting address by CEP: ", err)
+		logging.Logger.ErrorContext(ctx, "Error getting address by CEP", "error", err)
 		return nil, err
 	}
 	span.AddEvent("Launching Request to external service")
+	defer func(start time.Time) { i.recordDuration(ctx, start, err) }(time.Now())
 	resp, err := i.Client.Do(req)
-	if err != nil {
-		logging.Logger.Error("Error getting weather service: ", err)
+	if errors.Is(err, ErrQuotaExhausted) {
+		return nil, err
+	} else if err != nil {
+		logging.Logger.ErrorContext(ctx, "Error getting weather service", "error", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logging.Logger.Error("Error reading response body: ", err)
+		logging.Logger.ErrorContext(ctx, "Error reading response body", "error", err)
 		return nil, err
 	} else if resp.StatusCode != 200 {
 		switch resp.StatusCode {
 		case 404:
 			return nil, ErrCEPNotFound
+		case 503:
+			return nil, ErrServiceUnavailable
 		default:
 			return nil, fmt.Errorf("error getting address from internal service: %v", body)
 		}
@@ -71,19 +75,51 @@ func (i *InternalWeatherAPIService) GetWeather(ctx context.Context, zipCode stri
 	var internalWeatherResponse InternalWeatherResponse
 	err = json.Unmarshal(body, &internalWeatherResponse)
 	if err != nil {
-		logging.Logger.Error("Error unmarshalling response body: ", err)
+		logging.Logger.ErrorContext(ctx, "Error unmarshalling response body", "error", err)
 		return nil, err
 	}
 
 	return &internalWeatherResponse, nil
 }
 
-func NewInternalWeatherService() InternalWeatherService {
+// InternalWeatherServiceUpstream names the weather service as an upstream of
+// the input service
+const InternalWeatherServiceUpstream = "weather-service"
+
+func NewInternalWeatherService(serviceURL string, upstreams internals.UpstreamsConfig) InternalWeatherService {
 	return &InternalWeatherAPIService{
-		ServiceUrl: environment.GetEnvOrDefault("WEATHER_SERVICE_URL", "http://localhost:8081"),
-		BaseHttpService: BaseHttpService{
-			Client: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
-			Tracer: otel.Tracer(""),
-		},
+		ServiceUrl: serviceURL,
+		BaseHttpService: newBaseHttpServiceWithAttempts(InternalWeatherServiceUpstream, upstreams, func(next internals.HTTPClient) internals.HTTPClient {
+			return quotaExhaustedClient{next: next}
+		}),
+	}
+}
+
+// quotaExhaustedClient sits under the retry layer and turns the weather
+// service 503 quota_exhausted answers into a QuotaExhaustedError, so they are
+// neither retried nor counted by the circuit breaker.
+type quotaExhaustedClient struct {
+	next internals.HTTPClient
+}
+
+func (c quotaExhaustedClient) Do(req *http.Request) (*http.Response, error) {
+	resp, err := c.next.Do(req)
+	if err != nil || resp.StatusCode != http.StatusServiceUnavailable {
+		return resp, err
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 256))
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	if string(body) != ErrQuotaExhausted.Error() {
+		resp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), resp.Body), resp.Body}
+		return resp, nil
 	}
+	resp.Body.Close()
+	retryAfter, _ := internals.ParseRetryAfter(resp)
+	return nil, &QuotaExhaustedError{RetryAfter: retryAfter}
 }
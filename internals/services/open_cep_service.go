@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
+
+const (
+	OpenCEP_URL = "https://opencep.com/v1/%s"
+)
+
+// OpenCEPService is a service to interact with the OpenCEP API
+type OpenCEPService struct {
+	BaseHttpService
+	URL string
+}
+
+type OpenCEPResponse struct {
+	Cep         string `json:"cep"`
+	Logradouro  string `json:"logradouro"`
+	Complemento string `json:"complemento"`
+	Bairro      string `json:"bairro"`
+	Localidade  string `json:"localidade"`
+	Uf          string `json:"uf"`
+	Ibge        string `json:"ibge"`
+}
+
+// NewOpenCEPService creates a new OpenCEPService
+func NewOpenCEPService(upstreams internals.UpstreamsConfig) CEPService {
+	return &OpenCEPService{
+		BaseHttpService: newBaseHttpService(CEPProviderOpenCEP, upstreams),
+		URL:             OpenCEP_URL,
+	}
+}
+
+// GetAddressByCEP returns the address for a given CEP
+func (o *OpenCEPService) GetAddressByCEP(ctx context.Context, cep string) (*Address, error) {
+	ctx, span := o.Tracer.Start(ctx, "OpenCEPService.GetAddressByCEP")
+	defer span.End()
+
+	var response OpenCEPResponse
+	statusCode, err := o.getJSON(ctx, fmt.Sprintf(o.URL, cep), &response)
+	if err != nil {
+		return nil, err
+	}
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrCEPNotFound
+	case http.StatusBadRequest:
+		return nil, ErrInvalidCEP
+	default:
+		return nil, fmt.Errorf("error getting address from opencep: %d", statusCode)
+	}
+
+	return &Address{
+		CEP:          response.Cep,
+		Street:       response.Logradouro,
+		Neighborhood: response.Bairro,
+		City:         response.Localidade,
+		State:        response.Uf,
+		Provider:     CEPProviderOpenCEP,
+	}, nil
+}
@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
+
+const (
+	OpenMeteoGeocoding_URL = "https://geocoding-api.open-meteo.com/v1/search"
+	OpenMeteoForecast_URL  = "https://api.open-meteo.com/v1/forecast"
+)
+
+// OpenMeteoService is a service to interact with the Open-Meteo API, which
+// does not need a key. Cities are geocoded before querying the weather by
+// latitude and longitude.
+type OpenMeteoService struct {
+	BaseHttpService
+	GeocodingURL string
+	ForecastURL  string
+}
+
+type OpenMeteoGeocodingResult struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Country   string  `json:"country"`
+	Admin1    string  `json:"admin1"`
+	Timezone  string  `json:"timezone"`
+}
+
+type OpenMeteoGeocodingResponse struct {
+	Results []OpenMeteoGeocodingResult `json:"results"`
+}
+
+type OpenMeteoForecastResponse struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Current   struct {
+		Time          int64   `json:"time"`
+		Temperature2m float64 `json:"temperature_2m"`
+	} `json:"current"`
+}
+
+// NewOpenMeteoService creates a new OpenMeteoService
+func NewOpenMeteoService(upstreams internals.UpstreamsConfig) WeatherService {
+	return &OpenMeteoService{
+		BaseHttpService: newBaseHttpService(WeatherProviderOpenMeteo, upstreams),
+		GeocodingURL:    OpenMeteoGeocoding_URL,
+		ForecastURL:     OpenMeteoForecast_URL,
+	}
+}
+
+// GetWeather queries Open-Meteo by coordinates when known. Otherwise the city
+// is geocoded first, picking the result in the requested state.
+func (o *OpenMeteoService) GetWeather(ctx context.Context, location WeatherLocation) (*WeatherAPIResponse, error) {
+	ctx, span := o.Tracer.Start(ctx, "OpenMeteoService.GetWeather")
+	defer span.End()
+
+	var weather WeatherAPIResponse
+	weather.Location.Name = location.City
+	if location.HasCoordinates() {
+		weather.Location.Lat = *location.Latitude
+		weather.Location.Lon = *location.Longitude
+	} else {
+		geocoded, err := o.geocode(ctx, location)
+		if err != nil {
+			return nil, err
+		}
+		weather.Location.Name = geocoded.Name
+		weather.Location.Region = geocoded.Admin1
+		weather.Location.Country = geocoded.Country
+		weather.Location.Lat = geocoded.Latitude
+		weather.Location.Lon = geocoded.Longitude
+		weather.Location.TzID = geocoded.Timezone
+		if err := location.validate(ctx, WeatherProviderOpenMeteo, &weather); err != nil {
+			return nil, err
+		}
+	}
+
+	params := url.Values{}
+	params.Add("latitude", strconv.FormatFloat(weather.Location.Lat, 'f', -1, 64))
+	params.Add("longitude", strconv.FormatFloat(weather.Location.Lon, 'f', -1, 64))
+	params.Add("current", "temperature_2m")
+	params.Add("timeformat", "unixtime")
+	var forecast OpenMeteoForecastResponse
+	statusCode, err := o.getJSON(ctx, o.ForecastURL+"?"+params.Encode(), &forecast)
+	if err != nil {
+		return nil, err
+	} else if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("error getting weather from open-meteo: %d", statusCode)
+	}
+
+	weather.Current.LastUpdatedEpoch = int(forecast.Current.Time)
+	weather.Current.TempC = forecast.Current.Temperature2m
+	weather.Current.TempF = celsiusToFahrenheit(forecast.Current.Temperature2m)
+	return &weather, nil
+}
+
+// geocode returns the city in the requested state, or the first one found
+// when none is, which then fails the location validation
+func (o *OpenMeteoService) geocode(ctx context.Context, location WeatherLocation) (*OpenMeteoGeocodingResult, error) {
+	params := url.Values{}
+	params.Add("name", location.City)
+	params.Add("count", "10")
+	params.Add("countryCode", "BR")
+	params.Add("format", "json")
+	var geocoding OpenMeteoGeocodingResponse
+	statusCode, err := o.getJSON(ctx, o.GeocodingURL+"?"+params.Encode(), &geocoding)
+	if err != nil {
+		return nil, err
+	} else if statusCode != http.StatusOK {
+		return nil, fmt.Errorf("error geocoding city on open-meteo: %d", statusCode)
+	} else if len(geocoding.Results) == 0 {
+		return nil, ErrLocationNotFound
+	}
+	for i := range geocoding.Results {
+		if location.matchesState(geocoding.Results[i].Admin1) {
+			return &geocoding.Results[i], nil
+		}
+	}
+	return &geocoding.Results[0], nil
+}
+
+func celsiusToFahrenheit(celsius float64) float64 {
+	return celsius*1.8 + 32
+}
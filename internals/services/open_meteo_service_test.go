@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
+
+// fakeOpenMeteo is a stand-in Open-Meteo answering the geocoding and the
+// forecast with the given status codes and bodies
+type fakeOpenMeteo struct {
+	*httptest.Server
+
+	geocodingStatus int
+	geocodingBody   string
+	forecastStatus  int
+	forecastBody    string
+
+	mu sync.Mutex
+	// geocoded and forecasts are the queries received
+	geocoded  []url.Values
+	forecasts []url.Values
+}
+
+func startOpenMeteo(t *testing.T) *fakeOpenMeteo {
+	t.Helper()
+	f := &fakeOpenMeteo{}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakeOpenMeteo) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status, body := f.forecastStatus, f.forecastBody
+	if r.URL.Path == "/geocoding" {
+		f.geocoded = append(f.geocoded, r.URL.Query())
+		status, body = f.geocodingStatus, f.geocodingBody
+	} else {
+		f.forecasts = append(f.forecasts, r.URL.Query())
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+// queries returns the geocoding and forecast queries received
+func (f *fakeOpenMeteo) queries() ([]url.Values, []url.Values) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]url.Values(nil), f.geocoded...), append([]url.Values(nil), f.forecasts...)
+}
+
+func TestOpenMeteoService(t *testing.T) {
+	lat, lon := -23.55, -46.63
+	const bomJesus = `{"results": [
+		{"name": "Bom Jesus", "latitude": -9.07, "longitude": -44.36, "country": "Brasil", "admin1": "Piauí", "timezone": "America/Fortaleza"},
+		{"name": "Bom Jesus", "latitude": -28.67, "longitude": -50.43, "country": "Brasil", "admin1": "Rio Grande do Sul", "timezone": "America/Sao_Paulo"}
+	]}`
+	tests := []struct {
+		name            string
+		location        WeatherLocation
+		geocodingStatus int
+		geocodingBody   string
+		forecastStatus  int
+		forecastBody    string
+		// wantErr is the error returned, wantErrText part of its message
+		wantErr     error
+		wantErrText string
+		wantRegion  string
+		// wantLatitude is the latitude the forecast is queried for
+		wantLatitude string
+		wantTempC    float64
+		wantTempF    float64
+		wantGeocoded bool
+	}{
+		{
+			name:           "coordinates skip the geocoding",
+			location:       WeatherLocation{City: "São Paulo", State: "SP", Latitude: &lat, Longitude: &lon},
+			forecastStatus: http.StatusOK,
+			forecastBody:   `{"current": {"time": 1700000000, "temperature_2m": 25}}`,
+			wantLatitude:   "-23.55",
+			wantTempC:      25,
+			wantTempF:      77,
+		},
+		{
+			name:            "geocoded city in the requested state",
+			location:        WeatherLocation{City: "Bom Jesus", State: "RS"},
+			geocodingStatus: http.StatusOK,
+			geocodingBody:   bomJesus,
+			forecastStatus:  http.StatusOK,
+			forecastBody:    `{"current": {"time": 1700000000, "temperature_2m": 0}}`,
+			wantRegion:      "Rio Grande do Sul",
+			wantLatitude:    "-28.67",
+			wantTempC:       0,
+			wantTempF:       32,
+			wantGeocoded:    true,
+		},
+		{
+			name:            "negative temperature",
+			location:        WeatherLocation{City: "Bom Jesus", State: "PI"},
+			geocodingStatus: http.StatusOK,
+			geocodingBody:   bomJesus,
+			forecastStatus:  http.StatusOK,
+			forecastBody:    `{"current": {"time": 1700000000, "temperature_2m": -40}}`,
+			wantRegion:      "Piauí",
+			wantLatitude:    "-9.07",
+			wantTempC:       -40,
+			wantTempF:       -40,
+			wantGeocoded:    true,
+		},
+		{
+			name:            "city not found",
+			location:        WeatherLocation{City: "Atlantis", State: "SP"},
+			geocodingStatus: http.StatusOK,
+			geocodingBody:   `{}`,
+			wantErr:         ErrLocationNotFound,
+			wantGeocoded:    true,
+		},
+		{
+			name:            "city not in the requested state",
+			location:        WeatherLocation{City: "Bom Jesus", State: "SP"},
+			geocodingStatus: http.StatusOK,
+			geocodingBody:   bomJesus,
+			wantErr:         ErrLocationMismatch,
+			wantGeocoded:    true,
+		},
+		{
+			name:            "geocoding failure",
+			location:        WeatherLocation{City: "Bom Jesus", State: "RS"},
+			geocodingStatus: http.StatusInternalServerError,
+			wantErrText:     "error geocoding city on open-meteo: 500",
+			wantGeocoded:    true,
+		},
+		{
+			name:           "forecast failure",
+			location:       WeatherLocation{City: "São Paulo", State: "SP", Latitude: &lat, Longitude: &lon},
+			forecastStatus: http.StatusBadRequest,
+			forecastBody:   `{"error": true, "reason": "invalid latitude"}`,
+			wantErrText:    "error getting weather from open-meteo: 400",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream := startOpenMeteo(t)
+			upstream.geocodingStatus, upstream.geocodingBody = tt.geocodingStatus, tt.geocodingBody
+			upstream.forecastStatus, upstream.forecastBody = tt.forecastStatus, tt.forecastBody
+			service := NewOpenMeteoService(internals.UpstreamsConfig{}).(*OpenMeteoService)
+			service.GeocodingURL = upstream.URL + "/geocoding"
+			service.ForecastURL = upstream.URL + "/forecast"
+
+			weather, err := service.GetWeather(context.Background(), tt.location)
+			geocoded, forecasts := upstream.queries()
+			if len(geocoded) > 0 != tt.wantGeocoded {
+				t.Errorf("geocoded %v, want %v", len(geocoded) > 0, tt.wantGeocoded)
+			}
+			if tt.wantErr != nil || tt.wantErrText != "" {
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErrText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantGeocoded && geocoded[0].Get("name") != tt.location.City {
+				t.Errorf("geocoded %q, want %q", geocoded[0].Get("name"), tt.location.City)
+			}
+			if len(forecasts) != 1 {
+				t.Fatalf("got %d forecast requests, want 1", len(forecasts))
+			}
+			if got := forecasts[0].Get("latitude"); got != tt.wantLatitude {
+				t.Errorf("forecast queried for latitude %s, want %s", got, tt.wantLatitude)
+			}
+			if weather.Location.Region != tt.wantRegion {
+				t.Errorf("got region %q, want %q", weather.Location.Region, tt.wantRegion)
+			}
+			if weather.Current.LastUpdatedEpoch != 1700000000 {
+				t.Errorf("got last updated %d, want 1700000000", weather.Current.LastUpdatedEpoch)
+			}
+			if math.Abs(weather.Current.TempC-tt.wantTempC) > 1e-9 || math.Abs(weather.Current.TempF-tt.wantTempF) > 1e-9 {
+				t.Errorf("got %g°C %g°F, want %g°C %g°F", weather.Current.TempC, weather.Current.TempF, tt.wantTempC, tt.wantTempF)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
+
+const (
+	OpenWeatherMap_URL = "https://api.openweathermap.org/data/2.5/weather"
+)
+
+// OpenWeatherMapService is a service to interact with the OpenWeatherMap API
+type OpenWeatherMapService struct {
+	apiKey string
+	BaseHttpService
+	URL string
+}
+
+type OpenWeatherMapResponse struct {
+	Coord struct {
+		Lon float64 `json:"lon"`
+		Lat float64 `json:"lat"`
+	} `json:"coord"`
+	Main struct {
+		Temp float64 `json:"temp"`
+	} `json:"main"`
+	Dt  int64 `json:"dt"`
+	Sys struct {
+		Country string `json:"country"`
+	} `json:"sys"`
+	Name string `json:"name"`
+}
+
+// NewOpenWeatherMapService creates a new OpenWeatherMapService
+func NewOpenWeatherMapService(apiKey string, upstreams internals.UpstreamsConfig) WeatherService {
+	return &OpenWeatherMapService{
+		apiKey:          apiKey,
+		BaseHttpService: newBaseHttpService(WeatherProviderOpenWeatherMap, upstreams),
+		URL:             OpenWeatherMap_URL,
+	}
+}
+
+// GetWeather queries OpenWeatherMap by coordinates when known, or by city
+// otherwise. OpenWeatherMap only supports state codes for the US, so the
+// state can not be sent nor validated.
+func (o *OpenWeatherMapService) GetWeather(ctx context.Context, location WeatherLocation) (*WeatherAPIResponse, error) {
+	ctx, span := o.Tracer.Start(ctx, "OpenWeatherMapService.GetWeather")
+	defer span.End()
+
+	params := url.Values{}
+	params.Add("appid", o.apiKey)
+	if location.HasCoordinates() {
+		params.Add("lat", strconv.FormatFloat(*location.Latitude, 'f', -1, 64))
+		params.Add("lon", strconv.FormatFloat(*location.Longitude, 'f', -1, 64))
+	} else {
+		params.Add("q", location.City+",BR")
+	}
+	params.Add("units", "metric")
+	var response OpenWeatherMapResponse
+	statusCode, err := o.getJSON(ctx, o.URL+"?"+params.Encode(), &response)
+	if err != nil {
+		return nil, err
+	}
+	switch statusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrLocationNotFound
+	default:
+		return nil, fmt.Errorf("error getting weather from openweathermap: %d", statusCode)
+	}
+
+	var weather WeatherAPIResponse
+	weather.Location.Name = response.Name
+	weather.Location.Country = response.Sys.Country
+	weather.Location.Lat = response.Coord.Lat
+	weather.Location.Lon = response.Coord.Lon
+	weather.Current.LastUpdatedEpoch = int(response.Dt)
+	weather.Current.TempC = response.Main.Temp
+	weather.Current.TempF = celsiusToFahrenheit(response.Main.Temp)
+	if err := location.validate(ctx, WeatherProviderOpenWeatherMap, &weather); err != nil {
+		return nil, err
+	}
+	return &weather, nil
+}
@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
+
+func TestOpenWeatherMapService(t *testing.T) {
+	lat, lon := -23.55, -46.63
+	tests := []struct {
+		name     string
+		location WeatherLocation
+		status   int
+		body     string
+		// wantErr is the error returned, wantErrText part of its message
+		wantErr     error
+		wantErrText string
+		// wantQuery are the query parameters expected to be sent
+		wantQuery map[string]string
+		wantName  string
+		wantTempC float64
+		wantTempF float64
+	}{
+		{
+			name:      "by city",
+			location:  WeatherLocation{City: "São Paulo", State: "SP"},
+			status:    http.StatusOK,
+			body:      `{"coord": {"lon": -46.63, "lat": -23.55}, "main": {"temp": 25}, "dt": 1700000000, "sys": {"country": "BR"}, "name": "São Paulo"}`,
+			wantQuery: map[string]string{"q": "São Paulo,BR", "appid": "secret", "units": "metric", "lat": ""},
+			wantName:  "São Paulo",
+			wantTempC: 25,
+			wantTempF: 77,
+		},
+		{
+			name:      "by coordinates",
+			location:  WeatherLocation{City: "São Paulo", State: "SP", Latitude: &lat, Longitude: &lon},
+			status:    http.StatusOK,
+			body:      `{"coord": {"lon": -46.63, "lat": -23.55}, "main": {"temp": -40}, "dt": 1700000000, "sys": {"country": "BR"}, "name": "Sé"}`,
+			wantQuery: map[string]string{"lat": "-23.55", "lon": "-46.63", "units": "metric", "q": ""},
+			wantName:  "Sé",
+			wantTempC: -40,
+			wantTempF: -40,
+		},
+		{
+			name:      "freezing point",
+			location:  WeatherLocation{City: "Urupema", State: "SC"},
+			status:    http.StatusOK,
+			body:      `{"main": {"temp": 0}, "dt": 1700000000, "sys": {"country": "BR"}, "name": "Urupema"}`,
+			wantName:  "Urupema",
+			wantTempC: 0,
+			wantTempF: 32,
+		},
+		{
+			name:     "city not found",
+			location: WeatherLocation{City: "Atlantis", State: "SP"},
+			status:   http.StatusNotFound,
+			body:     `{"cod": "404", "message": "city not found"}`,
+			wantErr:  ErrLocationNotFound,
+		},
+		{
+			name:     "city outside Brazil",
+			location: WeatherLocation{City: "Springfield", State: "SP"},
+			status:   http.StatusOK,
+			body:     `{"main": {"temp": 10}, "dt": 1700000000, "sys": {"country": "US"}, "name": "Springfield"}`,
+			wantErr:  ErrLocationMismatch,
+		},
+		{
+			name:        "invalid key",
+			location:    WeatherLocation{City: "São Paulo", State: "SP"},
+			status:      http.StatusUnauthorized,
+			body:        `{"cod": 401, "message": "Invalid API key"}`,
+			wantErrText: "error getting weather from openweathermap: 401",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var queries []url.Values
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				queries = append(queries, r.URL.Query())
+				mu.Unlock()
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer upstream.Close()
+			service := NewOpenWeatherMapService("secret", internals.UpstreamsConfig{}).(*OpenWeatherMapService)
+			service.URL = upstream.URL
+
+			weather, err := service.GetWeather(context.Background(), tt.location)
+			if tt.wantErr != nil || tt.wantErrText != "" {
+				if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				if err == nil || !strings.Contains(err.Error(), tt.wantErrText) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantErrText)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(queries) != 1 {
+				t.Fatalf("got %d requests, want 1", len(queries))
+			}
+			for key, want := range tt.wantQuery {
+				if got := queries[0].Get(key); got != want {
+					t.Errorf("got query %s=%q, want %q", key, got, want)
+				}
+			}
+			if weather.Location.Name != tt.wantName {
+				t.Errorf("got name %q, want %q", weather.Location.Name, tt.wantName)
+			}
+			if weather.Current.LastUpdatedEpoch != 1700000000 {
+				t.Errorf("got last updated %d, want 1700000000", weather.Current.LastUpdatedEpoch)
+			}
+			if math.Abs(weather.Current.TempC-tt.wantTempC) > 1e-9 || math.Abs(weather.Current.TempF-tt.wantTempF) > 1e-9 {
+				t.Errorf("got %g°C %g°F, want %g°C %g°F", weather.Current.TempC, weather.Current.TempF, tt.wantTempC, tt.wantTempF)
+			}
+		})
+	}
+}
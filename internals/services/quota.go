@@ -0,0 +1,253 @@
+package services
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/cache"
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"golang.org/x/time/rate"
+)
+
+// QuotaConfig configures the budget of calls to a paid upstream.
+type QuotaConfig struct {
+	// PerMinute is the amount of calls per minute, 0 means unlimited.
+	PerMinute int
+	// PerMonth is the amount of calls per calendar month (UTC), 0 means
+	// unlimited.
+	PerMonth int
+	// WarnRatio is the fraction of the monthly budget logging a warning and
+	// counted by the quota.warnings metric once reached.
+	WarnRatio float64
+	// StatePath is the bolt file the monthly counters are kept in, so they
+	// survive restarts. Empty keeps them in memory only.
+	StatePath string
+}
+
+// WeatherAPIQuotaConfigFromEnv reads the WeatherAPI budget from
+// WEATHER_API_RATE_PER_MINUTE, WEATHER_API_QUOTA_PER_MONTH,
+// WEATHER_API_QUOTA_WARN_PERCENT and WEATHER_API_QUOTA_STATE_PATH.
+func WeatherAPIQuotaConfigFromEnv(env environment.Source) QuotaConfig {
+	return QuotaConfig{
+		PerMinute: env.GetIntOrDefault("WEATHER_API_RATE_PER_MINUTE", 0),
+		PerMonth:  env.GetIntOrDefault("WEATHER_API_QUOTA_PER_MONTH", 0),
+		WarnRatio: float64(env.GetIntOrDefault("WEATHER_API_QUOTA_WARN_PERCENT", 80)) / 100,
+		StatePath: env.GetEnvOrDefault("WEATHER_API_QUOTA_STATE_PATH", "weatherapi-quota.db"),
+	}
+}
+
+// newQuotaStore opens the store of the monthly counters, nil when they are
+// kept in memory only
+func newQuotaStore(config QuotaConfig) cache.Store {
+	if config.PerMonth <= 0 || config.StatePath == "" {
+		return nil
+	}
+	store, err := cache.NewBoltStore(config.StatePath, 0, 0)
+	if err != nil {
+		logging.Logger.Error("Error opening the quota file, the monthly usage restarts from zero", "path", config.StatePath, "error", err)
+		return nil
+	}
+	return store
+}
+
+// quotaGuard limits the calls to an upstream with a token bucket refilled
+// every minute and a counter of the calls made in the calendar month (UTC),
+// reset when the next month starts. The counter is not a rolling window. It
+// is persisted on store, when set, under stateKey and the month.
+type quotaGuard struct {
+	upstream string
+	key      string
+	config   QuotaConfig
+	limiter  *rate.Limiter
+	store    cache.Store
+	stateKey string
+
+	mu     sync.Mutex
+	month  time.Time
+	used   int
+	warned bool
+
+	usage    metric.Float64Gauge
+	warnings metric.Int64Counter
+	rejected metric.Int64Counter
+}
+
+// newQuotaGuard creates the quotaGuard of an upstream key, key is only used
+// to label the metrics and logs. The usage of the month is read from store,
+// when set, under stateKey.
+func newQuotaGuard(upstream, key string, config QuotaConfig, store cache.Store, stateKey string) *quotaGuard {
+	limiter := rate.NewLimiter(rate.Inf, 0)
+	if config.PerMinute > 0 {
+		limiter = rate.NewLimiter(rate.Limit(float64(config.PerMinute)/60), config.PerMinute)
+	}
+	meter := otel.Meter("")
+	usage, err := meter.Float64Gauge(
+		"quota.usage",
+		metric.WithDescription("Fraction of the monthly call budget used"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	warnings, err := meter.Int64Counter(
+		"quota.warnings",
+		metric.WithDescription("Number of times the monthly call budget reached the warning threshold"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	rejected, err := meter.Int64Counter(
+		"quota.rejected",
+		metric.WithDescription("Number of calls not made because the budget ran out"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	q := &quotaGuard{
+		upstream: upstream,
+		key:      key,
+		config:   config,
+		limiter:  limiter,
+		store:    store,
+		stateKey: stateKey,
+		month:    startOfMonth(time.Now()),
+		usage:    usage,
+		warnings: warnings,
+		rejected: rejected,
+	}
+	q.used = q.load()
+	return q
+}
+
+// reserve counts a call, returning a *QuotaExhaustedError when the
+// per-minute or the monthly budget ran out
+func (q *quotaGuard) reserve(ctx context.Context) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+	now := time.Now()
+	if q.config.PerMonth > 0 && q.used >= q.config.PerMonth {
+		q.reject(ctx, "monthly")
+		return &QuotaExhaustedError{RetryAfter: q.month.AddDate(0, 1, 0).Sub(now)}
+	}
+	reservation := q.limiter.ReserveN(now, 1)
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		q.reject(ctx, "per_minute")
+		return &QuotaExhaustedError{RetryAfter: delay}
+	}
+	q.used++
+	q.save(ctx)
+	q.record(ctx)
+	return nil
+}
+
+// monthUsage returns the calls made this month and whether the monthly
+// budget ran out
+func (q *quotaGuard) monthUsage() (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rollover()
+	return q.used, q.config.PerMonth > 0 && q.used >= q.config.PerMonth
+}
+
+// rollover resets the counter when a new month starts, the caller must hold
+// the lock
+func (q *quotaGuard) rollover() {
+	if month := startOfMonth(time.Now()); month.After(q.month) {
+		q.month = month
+		q.used = q.load()
+		q.warned = false
+	}
+}
+
+// stateName is the store key of the counter of the current month
+func (q *quotaGuard) stateName() string {
+	return q.stateKey + "/" + q.month.Format("2006-01")
+}
+
+// load reads the calls made this month from the store, the caller must hold
+// the lock
+func (q *quotaGuard) load() int {
+	if q.store == nil {
+		return 0
+	}
+	value, ok, err := q.store.Get(q.stateName())
+	if err != nil || ok && len(value) != 8 {
+		logging.Logger.Error("Error reading the monthly usage, restarting from zero", "upstream", q.upstream, "key", q.key, "error", err)
+		return 0
+	}
+	if !ok {
+		return 0
+	}
+	return int(binary.BigEndian.Uint64(value))
+}
+
+// save writes the calls made this month to the store, the caller must hold
+// the lock
+func (q *quotaGuard) save(ctx context.Context) {
+	if q.store == nil {
+		return
+	}
+	value := binary.BigEndian.AppendUint64(nil, uint64(q.used))
+	// Kept until the month is over, the next month uses another key
+	ttl := q.month.AddDate(0, 1, 1).Sub(time.Now())
+	if err := q.store.Set(q.stateName(), value, ttl); err != nil {
+		logging.Logger.ErrorContext(ctx, "Error saving the monthly usage", "upstream", q.upstream, "key", q.key, "error", err)
+	}
+}
+
+func (q *quotaGuard) record(ctx context.Context) {
+	if q.config.PerMonth <= 0 {
+		return
+	}
+	ratio := float64(q.used) / float64(q.config.PerMonth)
+	attributes := metric.WithAttributes(attribute.String("upstream", q.upstream), attribute.String("key", q.key))
+	if q.usage != nil {
+		q.usage.Record(ctx, ratio, attributes)
+	}
+	if !q.warned && ratio >= q.config.WarnRatio {
+		q.warned = true
+		if q.warnings != nil {
+			q.warnings.Add(ctx, 1, attributes)
+		}
+		logging.Logger.WarnContext(ctx, "Monthly call budget almost exhausted", "upstream", q.upstream, "key", q.key, "used", q.used, "budget", q.config.PerMonth)
+	}
+}
+
+func (q *quotaGuard) reject(ctx context.Context, budget string) {
+	if q.rejected != nil {
+		q.rejected.Add(ctx, 1, metric.WithAttributes(
+			attribute.String("upstream", q.upstream),
+			attribute.String("key", q.key),
+			attribute.String("budget", budget),
+		))
+	}
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Validate checks the settings of the WeatherAPI budget, returning all the
+// invalid ones
+func (c QuotaConfig) Validate() error {
+	var errs []error
+	if c.PerMinute < 0 {
+		errs = append(errs, errors.New("WEATHER_API_RATE_PER_MINUTE can not be negative"))
+	}
+	if c.PerMonth < 0 {
+		errs = append(errs, errors.New("WEATHER_API_QUOTA_PER_MONTH can not be negative"))
+	}
+	if c.WarnRatio <= 0 || c.WarnRatio > 1 {
+		errs = append(errs, errors.New("WEATHER_API_QUOTA_WARN_PERCENT must be between 1 and 100"))
+	}
+	return errors.Join(errs...)
+}
@@ -1,11 +1,115 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
 	"github.com/rcbadiale/go_open_telemetry/internals"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type BaseHttpService struct {
-	Client internals.HTTPClient
-	Tracer trace.Tracer
+	Client   internals.HTTPClient
+	Tracer   trace.Tracer
+	Upstream string
+	Duration metric.Float64Histogram
+}
+
+// newBaseHttpService creates the instrumented client shared by the services
+// calling the given upstream, retrying the transient failures and failing
+// fast while the upstream circuit breaker is open, as set on upstreams.
+func newBaseHttpService(upstream string, upstreams internals.UpstreamsConfig) BaseHttpService {
+	return newBaseHttpServiceWithAttempts(upstream, upstreams, nil)
+}
+
+// newBaseHttpServiceWithAttempts is newBaseHttpService with attempts, when
+// set, decorating the client under the retry layer so it sees every attempt.
+func newBaseHttpServiceWithAttempts(upstream string, upstreams internals.UpstreamsConfig, attempts func(internals.HTTPClient) internals.HTTPClient) BaseHttpService {
+	duration, err := otel.Meter("").Float64Histogram(
+		"upstream.request.duration",
+		metric.WithDescription("Duration of the calls made to upstream services"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		otel.Handle(err)
+	}
+	// The settings are validated at startup, a failure here means they
+	// changed since then, e.g. the CA bundle was removed
+	var client internals.HTTPClient
+	httpClient, err := internals.NewHTTPClient(upstreams.HTTPClient(upstream))
+	if err != nil {
+		logging.Logger.Error("Error creating HTTP client, the requests will fail", "upstream", upstream, "error", err)
+		client = internals.NewFailingClient(err)
+	} else {
+		client = httpClient
+	}
+	if attempts != nil {
+		client = attempts(client)
+	}
+	return BaseHttpService{
+		Client: internals.NewCircuitBreakerClient(
+			internals.NewRetryClient(
+				internals.NewRedactClient(client),
+				upstreams.Retry,
+			),
+			upstream,
+			upstreams.CircuitBreaker,
+		),
+		Tracer:   otel.Tracer(""),
+		Upstream: upstream,
+		Duration: duration,
+	}
+}
+
+// recordDuration records the time spent on an upstream call started at start.
+func (b *BaseHttpService) recordDuration(ctx context.Context, start time.Time, err error) {
+	if b.Duration == nil {
+		return
+	}
+	b.Duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("upstream", b.Upstream),
+		attribute.Bool("error", err != nil),
+	))
+}
+
+// getJSON requests url decoding the JSON body into out when the upstream
+// answers 200, the status code is returned so callers can map the failures.
+func (b *BaseHttpService) getJSON(ctx context.Context, url string, out any) (_ int, err error) {
+	span := trace.SpanFromContext(ctx)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "Error generating request", "upstream", b.Upstream, "error", err)
+		return 0, err
+	}
+
+	span.AddEvent("Launching Request to external service")
+	defer func(start time.Time) { b.recordDuration(ctx, start, err) }(time.Now())
+	resp, err := b.Client.Do(req)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "Error calling upstream", "upstream", b.Upstream, "error", err)
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		logging.Logger.ErrorContext(ctx, "Error reading response body", "upstream", b.Upstream, "error", err)
+		return resp.StatusCode, err
+	} else if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, nil
+	}
+
+	if err := json.Unmarshal(body, out); err != nil {
+		logging.Logger.ErrorContext(ctx, "Error unmarshalling response body", "upstream", b.Upstream, "error", err)
+		return resp.StatusCode, fmt.Errorf("invalid response from %s: %w", b.Upstream, err)
+	}
+	return resp.StatusCode, nil
 }
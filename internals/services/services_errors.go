@@ -1,8 +1,52 @@
 package services
 
-import "errors"
+import (
+	"errors"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+)
 
 var (
-	ErrInvalidCEP  = errors.New("invalid CEP provided")
-	ErrCEPNotFound = errors.New("CEP not found")
+	ErrInvalidCEP       = errors.New("invalid CEP provided")
+	ErrCEPNotFound      = errors.New("CEP not found")
+	ErrLocationNotFound = errors.New("location not found")
+	ErrLocationMismatch = errors.New("weather location does not match the requested state")
+	// ErrServiceUnavailable is returned when the weather service answers 503.
+	ErrServiceUnavailable = errors.New("service unavailable")
+	// ErrQuotaExhausted is returned when the call budget of a paid upstream
+	// ran out.
+	ErrQuotaExhausted = errors.New("quota_exhausted")
+	// ErrNoWeatherAPIKey is returned when every WeatherAPI key is unhealthy.
+	ErrNoWeatherAPIKey = errors.New("no healthy WeatherAPI key")
 )
+
+// QuotaExhaustedError is returned, without calling the upstream, when its call
+// budget ran out. It matches ErrQuotaExhausted and internals.ErrRefused.
+type QuotaExhaustedError struct {
+	// RetryAfter is the time left until a call fits in the budget again.
+	RetryAfter time.Duration
+}
+
+func (e *QuotaExhaustedError) Error() string {
+	return ErrQuotaExhausted.Error()
+}
+
+func (e *QuotaExhaustedError) Is(target error) bool {
+	return target == ErrQuotaExhausted || target == internals.ErrRefused
+}
+
+// combineProviderErrors returns the sentinel error when all providers agree
+// on it, so it can be mapped by the handlers, or all the failures otherwise.
+func combineProviderErrors(errs []error) error {
+	for _, sentinel := range []error{ErrCEPNotFound, ErrInvalidCEP, ErrLocationNotFound, ErrLocationMismatch, internals.ErrCircuitOpen} {
+		agree := len(errs) > 0
+		for _, err := range errs {
+			agree = agree && errors.Is(err, sentinel)
+		}
+		if agree {
+			return sentinel
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,13 @@
+package services
+
+import (
+	"os"
+	"testing"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+)
+
+func TestMain(m *testing.M) {
+	logging.SetupLogger()
+	os.Exit(m.Run())
+}
@@ -6,21 +6,16 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"time"
 
+	"github.com/rcbadiale/go_open_telemetry/internals"
 	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
 )
 
 const (
 	ViaCEP_URL = "https://viacep.com.br/ws/%s/json/"
 )
 
-type CEPService interface {
-	GetAddressByCEP(ctx context.Context, cep string) (*ViaCEPResponse, error)
-}
-
 // ViaCEPService is a service to interact with the ViaCEP API
 type ViaCEPService struct {
 	BaseHttpService
@@ -41,52 +36,67 @@ type ViaCEPResponse struct {
 }
 
 // NewViaCEPService creates a new ViaCEPService
-func NewViaCEPService() CEPService {
+func NewViaCEPService(upstreams internals.UpstreamsConfig) CEPService {
 	return &ViaCEPService{
-		BaseHttpService{
-			Client: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
-			Tracer: otel.Tracer(""),
-		},
+		newBaseHttpService(CEPProviderViaCEP, upstreams),
 	}
 }
 
 // GetAddressByCEP returns the address for a given CEP
-func (v *ViaCEPService) GetAddressByCEP(ctx context.Context, cep string) (*ViaCEPResponse, error) {
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+func (v *ViaCEPService) GetAddressByCEP(ctx context.Context, cep string) (_ *Address, err error) {
 	ctx, span := v.Tracer.Start(ctx, "ViaCEPService.GetAddressByCEP")
 	defer span.End()
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(ViaCEP_URL, cep), nil)
 	if err != nil {
-		logging.Logger.Error("Error generating CEP request: ", err)
+		logging.Logger.ErrorContext(ctx, "Error generating CEP request", "error", err)
 		return nil, err
 	}
 
 	span.AddEvent("Launching Request to external service")
+	defer func(start time.Time) { v.recordDuration(ctx, start, err) }(time.Now())
 	resp, err := v.Client.Do(req)
 	if err != nil {
-		logging.Logger.Error("Error getting address by CEP: ", err)
+		logging.Logger.ErrorContext(ctx, "Error getting address by CEP", "error", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logging.Logger.Error("Error reading response body: ", err)
+		logging.Logger.ErrorContext(ctx, "Error reading response body", "error", err)
 		return nil, err
-	} else if resp.StatusCode != 200 {
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusBadRequest:
 		return nil, ErrInvalidCEP
+	default:
+		// Not a problem with the CEP, such as 429 or 5xx, so the next
+		// providers are tried
+		return nil, fmt.Errorf("error getting address from viacep: %d", resp.StatusCode)
 	}
 
 	var viaCepResponse ViaCEPResponse
 	err = json.Unmarshal(body, &viaCepResponse)
 	if err != nil {
-		logging.Logger.Error("Error unmarshalling response body: ", err)
+		logging.Logger.ErrorContext(ctx, "Error unmarshalling response body", "error", err)
 		return nil, err
 	} else if viaCepResponse.Erro == "true" {
-		logging.Logger.Error(fmt.Sprintf("Error invalid address by CEP: %v", viaCepResponse))
+		logging.Logger.ErrorContext(ctx, "Error invalid address by CEP", "cep", cep)
 		return nil, ErrCEPNotFound
 	}
 
-	return &viaCepResponse, nil
+	return viaCepResponse.toAddress(), nil
+}
+
+func (v *ViaCEPResponse) toAddress() *Address {
+	return &Address{
+		CEP:          v.Cep,
+		Street:       v.Logradouro,
+		Neighborhood: v.Bairro,
+		City:         v.Localidade,
+		State:        v.Uf,
+		Provider:     CEPProviderViaCEP,
+	}
 }
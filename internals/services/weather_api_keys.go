@@ -0,0 +1,397 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/cache"
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/filewatch"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+)
+
+// Rotations available to WEATHER_API_KEY_ROTATION
+const (
+	KeyRotationRoundRobin = "round-robin"
+	KeyRotationLeastUsed  = "least-used"
+)
+
+// WeatherAPIKeysConfig configures the WeatherAPI keys and how they rotate.
+type WeatherAPIKeysConfig struct {
+	Keys []string `secret:"true"`
+	// File holds the keys, one per line or comma separated, replacing Keys.
+	// It is read again on changes and on Reload.
+	File string
+	// WatchInterval is how often File is checked for changes, 0 disables it.
+	WatchInterval time.Duration
+	// Rotation is either KeyRotationRoundRobin or KeyRotationLeastUsed.
+	Rotation string
+	// CoolDown is how long a key stays unhealthy after being rejected.
+	CoolDown time.Duration
+	// Quota is the budget of calls of each key.
+	Quota QuotaConfig
+}
+
+// WeatherAPIKeysConfigFromEnv reads the comma separated keys from
+// WEATHER_API_KEYS, or the single WEATHER_API_KEY, or the file set on
+// WEATHER_API_KEY_FILE, and their settings from WEATHER_API_KEY_ROTATION,
+// WEATHER_API_KEY_COOLDOWN and SECRETS_WATCH_INTERVAL.
+func WeatherAPIKeysConfigFromEnv(env environment.Source) WeatherAPIKeysConfig {
+	return WeatherAPIKeysConfig{
+		Keys:          parseKeys(env.GetEnvOrDefault("WEATHER_API_KEYS", env.GetEnvOrDefault("WEATHER_API_KEY", ""))),
+		File:          env.GetEnvOrDefault("WEATHER_API_KEY_FILE", ""),
+		WatchInterval: env.GetDurationOrDefault("SECRETS_WATCH_INTERVAL", 10*time.Second),
+		Rotation:      env.GetEnvOrDefault("WEATHER_API_KEY_ROTATION", KeyRotationRoundRobin),
+		CoolDown:      env.GetDurationOrDefault("WEATHER_API_KEY_COOLDOWN", 15*time.Minute),
+		Quota:         WeatherAPIQuotaConfigFromEnv(env),
+	}
+}
+
+// parseKeys splits keys separated by commas or new lines
+func parseKeys(value string) []string {
+	var keys []string
+	for _, key := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' || r == '\r' }) {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// WeatherAPIKeyHealth is the state of a key, the key itself is never exposed.
+type WeatherAPIKeyHealth struct {
+	ID string `json:"id"`
+	// Fingerprint is the beginning of the key SHA-256, so a key can be
+	// identified without being revealed.
+	Fingerprint    string     `json:"fingerprint"`
+	Healthy        bool       `json:"healthy"`
+	Reason         string     `json:"reason,omitempty"`
+	UnhealthyUntil *time.Time `json:"unhealthy_until,omitempty"`
+	Calls          int64      `json:"calls"`
+	MonthCalls     int        `json:"month_calls"`
+	QuotaExhausted bool       `json:"quota_exhausted"`
+}
+
+// weatherAPIKey is a key with its own quota and health
+type weatherAPIKey struct {
+	id          string
+	value       string
+	fingerprint string
+	quota       *quotaGuard
+	calls       atomic.Int64
+
+	mu             sync.Mutex
+	reason         string
+	unhealthyUntil time.Time
+	// quotaExceeded tells whether WeatherAPI rejected the key for its quota
+	quotaExceeded bool
+}
+
+// reserve counts an attempt on the key quota
+func (k *weatherAPIKey) reserve(ctx context.Context) error {
+	if err := k.quota.reserve(ctx); err != nil {
+		return err
+	}
+	k.calls.Add(1)
+	return nil
+}
+
+func (k *weatherAPIKey) healthy(now time.Time) bool {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return !now.Before(k.unhealthyUntil)
+}
+
+// quotaRejected returns the time left until a key rejected by WeatherAPI for
+// its quota is tried again
+func (k *weatherAPIKey) quotaRejected(now time.Time) (time.Duration, bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.quotaExceeded || !now.Before(k.unhealthyUntil) {
+		return 0, false
+	}
+	return k.unhealthyUntil.Sub(now), true
+}
+
+// WeatherAPIKeyPool rotates the WeatherAPI keys, skipping the ones rejected
+// by WeatherAPI (invalid, disabled or out of quota) until their cool-down ends.
+// The keys can be replaced at any time, the requests already holding a key
+// keep using it.
+type WeatherAPIKeyPool struct {
+	keys   atomic.Pointer[[]*weatherAPIKey]
+	config WeatherAPIKeysConfig
+	next   atomic.Uint64
+
+	// mu serializes the key replacements
+	mu  sync.Mutex
+	seq int
+	// known holds the keys set by SHA-256, so a key removed and added back
+	// keeps its id, quota and health. A key removed for longer than the
+	// cool-down is forgotten, as its health has recovered by then and its
+	// usage is kept in quotaStore.
+	known map[[sha256.Size]byte]*weatherAPIKey
+	// removedAt is when each known key was removed
+	removedAt map[[sha256.Size]byte]time.Time
+	// quotaStore persists the monthly usage of the keys, nil keeps it in
+	// memory only
+	quotaStore cache.Store
+}
+
+// NewWeatherAPIKeyPool creates a WeatherAPIKeyPool with the keys read from the
+// keys file when there is one, or the configured ones otherwise
+func NewWeatherAPIKeyPool(config WeatherAPIKeysConfig) *WeatherAPIKeyPool {
+	if config.Rotation != KeyRotationRoundRobin && config.Rotation != KeyRotationLeastUsed {
+		logging.Logger.Error("Unknown key rotation, using round-robin", "rotation", config.Rotation)
+		config.Rotation = KeyRotationRoundRobin
+	}
+	pool := &WeatherAPIKeyPool{
+		config:     config,
+		known:      make(map[[sha256.Size]byte]*weatherAPIKey),
+		removedAt:  make(map[[sha256.Size]byte]time.Time),
+		quotaStore: newQuotaStore(config.Quota),
+	}
+	if config.File != "" {
+		err := pool.Reload(context.Background())
+		if err == nil {
+			return pool
+		}
+		logging.Logger.Error("Error reading WeatherAPI keys file, using the keys from the environment", "path", config.File, "error", err)
+	}
+	pool.SetKeys(config.Keys)
+	return pool
+}
+
+// SetKeys atomically replaces the keys. Keys set before, even when removed
+// in between, keep their id, usage, quota and health, unless removed for
+// longer than the cool-down.
+func (p *WeatherAPIKeyPool) SetKeys(values []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	keys := make([]*weatherAPIKey, 0, len(values))
+	current := make(map[[sha256.Size]byte]bool, len(values))
+	for _, value := range values {
+		sum := sha256.Sum256([]byte(value))
+		current[sum] = true
+		delete(p.removedAt, sum)
+		if key, ok := p.known[sum]; ok {
+			keys = append(keys, key)
+			continue
+		}
+		p.seq++
+		id := fmt.Sprintf("key-%d", p.seq)
+		key := &weatherAPIKey{
+			id:          id,
+			value:       value,
+			fingerprint: hex.EncodeToString(sum[:4]),
+			// The usage is stored under the key SHA-256, the id depending on
+			// the order the keys were set in
+			quota: newQuotaGuard(WeatherProviderWeatherAPI, id, p.config.Quota, p.quotaStore, WeatherProviderWeatherAPI+"/"+hex.EncodeToString(sum[:])),
+		}
+		p.known[sum] = key
+		keys = append(keys, key)
+	}
+	p.forgetRemoved(current)
+	p.keys.Store(&keys)
+}
+
+// forgetRemoved drops the known keys not in current for longer than the
+// cool-down. The caller must hold mu.
+func (p *WeatherAPIKeyPool) forgetRemoved(current map[[sha256.Size]byte]bool) {
+	now := time.Now()
+	for sum := range p.known {
+		if current[sum] {
+			continue
+		}
+		removedAt, ok := p.removedAt[sum]
+		if !ok {
+			p.removedAt[sum] = now
+			continue
+		}
+		if now.Sub(removedAt) > p.config.CoolDown {
+			delete(p.known, sum)
+			delete(p.removedAt, sum)
+		}
+	}
+}
+
+// Close releases the file the monthly usage is kept in
+func (p *WeatherAPIKeyPool) Close() error {
+	if p.quotaStore == nil {
+		return nil
+	}
+	return p.quotaStore.Close()
+}
+
+// Reload reads the keys file again, keeping the current keys when it can not
+// be read or is empty
+func (p *WeatherAPIKeyPool) Reload(ctx context.Context) error {
+	if p.config.File == "" {
+		return nil
+	}
+	content, err := os.ReadFile(p.config.File)
+	if err != nil {
+		return err
+	}
+	keys := parseKeys(string(content))
+	if len(keys) == 0 {
+		return fmt.Errorf("no key found in %s", p.config.File)
+	}
+	p.SetKeys(keys)
+	logging.Logger.InfoContext(ctx, "WeatherAPI keys reloaded", "path", p.config.File, "keys", len(keys))
+	return nil
+}
+
+// Watch reloads the keys every time the keys file changes, until ctx is done
+func (p *WeatherAPIKeyPool) Watch(ctx context.Context) {
+	if p.config.File == "" || p.config.WatchInterval <= 0 {
+		return
+	}
+	filewatch.Watch(ctx, p.config.File, p.config.WatchInterval, func() {
+		if err := p.Reload(ctx); err != nil {
+			logging.Logger.ErrorContext(ctx, "Error reloading WeatherAPI keys", "path", p.config.File, "error", err)
+		}
+	})
+}
+
+// Len returns the amount of keys
+func (p *WeatherAPIKeyPool) Len() int {
+	return len(p.snapshot())
+}
+
+// snapshot returns the current keys
+func (p *WeatherAPIKeyPool) snapshot() []*weatherAPIKey {
+	if keys := p.keys.Load(); keys != nil {
+		return *keys
+	}
+	return nil
+}
+
+// acquire returns the next healthy key with budget left, counting the first
+// attempt on its quota. A *QuotaExhaustedError is returned when no key is
+// usable and at least one ran out of budget, either ours or the one enforced
+// by WeatherAPI, and ErrNoWeatherAPIKey otherwise.
+func (p *WeatherAPIKeyPool) acquire(ctx context.Context) (*weatherAPIKey, error) {
+	now := time.Now()
+	var exhausted *QuotaExhaustedError
+	for _, key := range p.candidates() {
+		if !key.healthy(now) {
+			if retryAfter, ok := key.quotaRejected(now); ok {
+				exhausted = earliestQuota(exhausted, &QuotaExhaustedError{RetryAfter: retryAfter})
+			}
+			continue
+		}
+		if err := key.reserve(ctx); err != nil {
+			var quotaErr *QuotaExhaustedError
+			if errors.As(err, &quotaErr) {
+				exhausted = earliestQuota(exhausted, quotaErr)
+			}
+			continue
+		}
+		return key, nil
+	}
+	if exhausted != nil {
+		return nil, exhausted
+	}
+	return nil, ErrNoWeatherAPIKey
+}
+
+// earliestQuota returns the error of the budget allowing a call first
+func earliestQuota(current, err *QuotaExhaustedError) *QuotaExhaustedError {
+	if current == nil || err.RetryAfter < current.RetryAfter {
+		return err
+	}
+	return current
+}
+
+// candidates returns the keys in the order they should be tried
+func (p *WeatherAPIKeyPool) candidates() []*weatherAPIKey {
+	keys := p.snapshot()
+	candidates := make([]*weatherAPIKey, 0, len(keys))
+	if len(keys) == 0 {
+		return candidates
+	}
+	switch p.config.Rotation {
+	case KeyRotationLeastUsed:
+		candidates = append(candidates, keys...)
+		for i := 1; i < len(candidates); i++ {
+			for j := i; j > 0 && candidates[j].calls.Load() < candidates[j-1].calls.Load(); j-- {
+				candidates[j], candidates[j-1] = candidates[j-1], candidates[j]
+			}
+		}
+	default:
+		start := int((p.next.Add(1) - 1) % uint64(len(keys)))
+		for i := range keys {
+			candidates = append(candidates, keys[(start+i)%len(keys)])
+		}
+	}
+	return candidates
+}
+
+// reject marks a key unhealthy for the cool-down, quotaExceeded telling
+// whether WeatherAPI rejected it for its quota
+func (p *WeatherAPIKeyPool) reject(ctx context.Context, key *weatherAPIKey, reason string, quotaExceeded bool) {
+	key.mu.Lock()
+	defer key.mu.Unlock()
+	key.reason = reason
+	key.quotaExceeded = quotaExceeded
+	key.unhealthyUntil = time.Now().Add(p.config.CoolDown)
+	logging.Logger.WarnContext(ctx, "WeatherAPI key marked unhealthy", "key", key.id, "fingerprint", key.fingerprint, "reason", reason, "cooldown", p.config.CoolDown.String())
+}
+
+// Health returns the state of every key, without their values
+func (p *WeatherAPIKeyPool) Health() []WeatherAPIKeyHealth {
+	now := time.Now()
+	keys := p.snapshot()
+	health := make([]WeatherAPIKeyHealth, 0, len(keys))
+	for _, key := range keys {
+		month, exhausted := key.quota.monthUsage()
+		key.mu.Lock()
+		state := WeatherAPIKeyHealth{
+			ID:             key.id,
+			Fingerprint:    key.fingerprint,
+			Healthy:        !now.Before(key.unhealthyUntil),
+			Calls:          key.calls.Load(),
+			MonthCalls:     month,
+			QuotaExhausted: exhausted || key.quotaExceeded && now.Before(key.unhealthyUntil),
+		}
+		if !state.Healthy {
+			until := key.unhealthyUntil
+			state.Reason = key.reason
+			state.UnhealthyUntil = &until
+		}
+		key.mu.Unlock()
+		health = append(health, state)
+	}
+	return health
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c WeatherAPIKeysConfig) Validate() error {
+	var errs []error
+	if len(c.Keys) == 0 && c.File == "" {
+		errs = append(errs, errors.New("WEATHER_API_KEY, WEATHER_API_KEYS or WEATHER_API_KEY_FILE is required by the weatherapi provider"))
+	}
+	if c.File != "" {
+		if _, err := os.Stat(c.File); err != nil {
+			errs = append(errs, fmt.Errorf("WEATHER_API_KEY_FILE can not be read: %w", err))
+		}
+	}
+	if c.WatchInterval < 0 {
+		errs = append(errs, errors.New("SECRETS_WATCH_INTERVAL can not be negative"))
+	}
+	if c.Rotation != KeyRotationRoundRobin && c.Rotation != KeyRotationLeastUsed {
+		errs = append(errs, fmt.Errorf("WEATHER_API_KEY_ROTATION must be %s or %s, got %q", KeyRotationRoundRobin, KeyRotationLeastUsed, c.Rotation))
+	}
+	if c.CoolDown < 0 {
+		errs = append(errs, errors.New("WEATHER_API_KEY_COOLDOWN can not be negative"))
+	}
+	return errors.Join(append(errs, c.Quota.Validate())...)
+}
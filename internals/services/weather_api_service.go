@@ -3,29 +3,28 @@ package services
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"time"
 
+	"github.com/rcbadiale/go_open_telemetry/internals"
 	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
-	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
 	WeatherAPI_URL = "https://api.weatherapi.com/v1/current.json"
 )
 
-type WeatherService interface {
-	GetWeatherByCity(ctx context.Context, city string) (*WeatherAPIResponse, error)
-}
-
 // WeatherAPIService is a service to interact with the WeatherAPI API
 type WeatherAPIService struct {
-	apiKey string
+	keys *WeatherAPIKeyPool
 	BaseHttpService
+	URL string
 }
 type WeatherAPIResponseCurrent struct {
 	LastUpdatedEpoch int     `json:"last_updated_epoch"`
@@ -57,6 +56,8 @@ type WeatherAPIResponseCurrent struct {
 	GustKph    float64 `json:"gust_kph"`
 }
 
+// WeatherAPIResponse is the weather returned by every WeatherService, the
+// other providers fill in the fields they support
 type WeatherAPIResponse struct {
 	Location struct {
 		Name           string  `json:"name"`
@@ -71,54 +72,156 @@ type WeatherAPIResponse struct {
 	Current WeatherAPIResponseCurrent `json:"current"`
 }
 
-// NewWeatherAPIService creates a new WeatherAPIService
-func NewWeatherAPIService(apiKey string) WeatherService {
+// WeatherAPI error codes
+const (
+	// WeatherAPIErrNoLocationFound is returned when the queried location
+	// does not exist.
+	WeatherAPIErrNoLocationFound = 1006
+	// WeatherAPIErrQuotaExceeded is returned when the key exceeded its
+	// monthly calls.
+	WeatherAPIErrQuotaExceeded = 2007
+)
+
+type WeatherAPIErrorResponse struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// NewWeatherAPIService creates a new WeatherAPIService rotating the keys of
+// the pool
+func NewWeatherAPIService(keys *WeatherAPIKeyPool, upstreams internals.UpstreamsConfig) WeatherService {
 	return &WeatherAPIService{
-		apiKey,
-		BaseHttpService{
-			Client: &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)},
-			Tracer: otel.Tracer(""),
-		},
+		keys: keys,
+		BaseHttpService: newBaseHttpServiceWithAttempts(WeatherProviderWeatherAPI, upstreams, func(next internals.HTTPClient) internals.HTTPClient {
+			return quotaClient{next: next}
+		}),
+		URL: WeatherAPI_URL,
+	}
+}
+
+// keyAttempts is the key a request is sent with and its attempts so far
+type keyAttempts struct {
+	key  *weatherAPIKey
+	sent int
+}
+
+type keyAttemptsContextKey struct{}
+
+// quotaClient sits under the retry layer and counts the retries on the quota
+// of the key of the request, the first attempt being counted by acquire. A
+// retry is refused once the key budget ran out.
+type quotaClient struct {
+	next internals.HTTPClient
+}
+
+func (c quotaClient) Do(req *http.Request) (*http.Response, error) {
+	if attempts, ok := req.Context().Value(keyAttemptsContextKey{}).(*keyAttempts); ok {
+		if attempts.sent > 0 {
+			if err := attempts.key.reserve(req.Context()); err != nil {
+				return nil, err
+			}
+		}
+		attempts.sent++
 	}
+	return c.next.Do(req)
 }
 
-func (w *WeatherAPIService) GetWeatherByCity(ctx context.Context, city string) (*WeatherAPIResponse, error) {
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-	ctx, span := w.Tracer.Start(ctx, "WeatherAPIService.GetWeatherByCity")
+// errKeyRejected is returned when WeatherAPI rejects a key, the request is
+// then retried with the next key
+var errKeyRejected = errors.New("WeatherAPI key rejected")
+
+// GetWeather queries WeatherAPI by coordinates when known, or by
+// "city,UF,Brazil" otherwise. Calls fail with ErrQuotaExhausted once no key
+// has budget left, including the keys WeatherAPI rejected for their quota.
+func (w *WeatherAPIService) GetWeather(ctx context.Context, location WeatherLocation) (*WeatherAPIResponse, error) {
+	ctx, span := w.Tracer.Start(ctx, "WeatherAPIService.GetWeather")
 	defer span.End()
 
-	base, _ := url.Parse(WeatherAPI_URL)
+	var err error = ErrNoWeatherAPIKey
+	for attempt := 0; attempt < max(w.keys.Len(), 1); attempt++ {
+		key, acquireErr := w.keys.acquire(ctx)
+		if acquireErr != nil {
+			span.AddEvent("No WeatherAPI key available", trace.WithAttributes(attribute.String("error", acquireErr.Error())))
+			return nil, acquireErr
+		}
+		span.SetAttributes(attribute.String("weatherapi.key", key.id))
+		weather, queryErr := w.query(context.WithValue(ctx, keyAttemptsContextKey{}, &keyAttempts{key: key}), key, location)
+		switch {
+		case queryErr == errKeyRejected:
+			// The next key is tried, the quota rejections are reported once
+			// every key was rejected
+			if retryAfter, ok := key.quotaRejected(time.Now()); ok {
+				err = &QuotaExhaustedError{RetryAfter: retryAfter}
+			}
+		case errors.Is(queryErr, ErrQuotaExhausted):
+			// The key budget ran out while retrying, the next key is tried
+			err = queryErr
+		default:
+			return weather, queryErr
+		}
+	}
+	return nil, err
+}
+
+func (w *WeatherAPIService) query(ctx context.Context, key *weatherAPIKey, location WeatherLocation) (_ *WeatherAPIResponse, err error) {
+	span := trace.SpanFromContext(ctx)
+	base, err := url.Parse(w.URL)
+	if err != nil {
+		return nil, err
+	}
 	params := url.Values{}
-	params.Add("key", w.apiKey)
-	params.Add("q", city)
+	params.Add("key", key.value)
+	if location.HasCoordinates() {
+		params.Add("q", location.Coordinates())
+	} else {
+		params.Add("q", location.String())
+	}
 	base.RawQuery = params.Encode()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, base.String(), nil)
 	if err != nil {
-		logging.Logger.Error("Error getting weather: ", err)
+		logging.Logger.ErrorContext(ctx, "Error getting weather", "error", err)
 		return nil, err
 	}
 	span.AddEvent("Launching Request to external service")
+	defer func(start time.Time) { w.recordDuration(ctx, start, err) }(time.Now())
 	resp, err := w.Client.Do(req)
 	if err != nil {
-		logging.Logger.Error("Error getting weather: ", err)
+		logging.Logger.ErrorContext(ctx, "Error getting weather", "error", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		logging.Logger.Error(fmt.Sprintf("Error getting weather: statusCode:%d Response:%s", resp.StatusCode, resp.Body))
-		return nil, fmt.Errorf("error getting weather: %d", resp.StatusCode)
-	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		logging.Logger.Error("Error reading response body: ", err)
+		logging.Logger.ErrorContext(ctx, "Error reading response body", "error", err)
 		return nil, err
 	}
+	if resp.StatusCode != 200 {
+		var errorResponse WeatherAPIErrorResponse
+		json.Unmarshal(body, &errorResponse)
+		switch {
+		case errorResponse.Error.Code == WeatherAPIErrNoLocationFound:
+			return nil, ErrLocationNotFound
+		case errorResponse.Error.Code == WeatherAPIErrQuotaExceeded:
+			w.keys.reject(ctx, key, "quota exceeded", true)
+			return nil, errKeyRejected
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			w.keys.reject(ctx, key, fmt.Sprintf("%d %s", errorResponse.Error.Code, errorResponse.Error.Message), false)
+			return nil, errKeyRejected
+		}
+		logging.Logger.ErrorContext(ctx, "Error getting weather", "status_code", resp.StatusCode, "error_code", errorResponse.Error.Code)
+		return nil, fmt.Errorf("error getting weather: %d", resp.StatusCode)
+	}
 
 	var weatherResponse WeatherAPIResponse
 	err = json.Unmarshal(body, &weatherResponse)
 	if err != nil {
-		logging.Logger.Error("Error unmarshalling response body: ", err)
+		logging.Logger.ErrorContext(ctx, "Error unmarshalling response body", "error", err)
+		return nil, err
+	}
+	if err = location.validate(ctx, WeatherProviderWeatherAPI, &weatherResponse); err != nil {
 		return nil, err
 	}
 
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"strconv"
+	"strings"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+)
+
+// WeatherLocation is the location the weather is queried for. The state is
+// sent along with the city, as city names such as "São José" or "Bom Jesus"
+// exist in several states, and the coordinates are preferred when the CEP
+// provider returns them.
+type WeatherLocation struct {
+	City string
+	// State is the UF, e.g. "SP".
+	State     string
+	Latitude  *float64
+	Longitude *float64
+}
+
+// WeatherLocationFromAddress creates the WeatherLocation of an Address
+func WeatherLocationFromAddress(address *Address) WeatherLocation {
+	return WeatherLocation{
+		City:      address.City,
+		State:     strings.ToUpper(strings.TrimSpace(address.State)),
+		Latitude:  address.Latitude,
+		Longitude: address.Longitude,
+	}
+}
+
+// HasCoordinates reports whether the latitude and longitude are known
+func (l WeatherLocation) HasCoordinates() bool {
+	return l.Latitude != nil && l.Longitude != nil
+}
+
+// Coordinates formats the location as "lat,lon"
+func (l WeatherLocation) Coordinates() string {
+	return strconv.FormatFloat(*l.Latitude, 'f', -1, 64) + "," + strconv.FormatFloat(*l.Longitude, 'f', -1, 64)
+}
+
+// String formats the location as "city,UF,Brazil"
+func (l WeatherLocation) String() string {
+	if l.State == "" {
+		return l.City + ",Brazil"
+	}
+	return l.City + "," + l.State + ",Brazil"
+}
+
+// key is the cache key of the location, coordinates are left out as every
+// address of a city shares the same weather.
+func (l WeatherLocation) key() string {
+	return normalizeLocation(l.City + "," + l.State)
+}
+
+// brazilianStates maps the UFs to the state names returned by the weather
+// providers
+var brazilianStates = map[string]string{
+	"AC": "Acre",
+	"AL": "Alagoas",
+	"AP": "Amapá",
+	"AM": "Amazonas",
+	"BA": "Bahia",
+	"CE": "Ceará",
+	"DF": "Distrito Federal",
+	"ES": "Espírito Santo",
+	"GO": "Goiás",
+	"MA": "Maranhão",
+	"MT": "Mato Grosso",
+	"MS": "Mato Grosso do Sul",
+	"MG": "Minas Gerais",
+	"PA": "Pará",
+	"PB": "Paraíba",
+	"PR": "Paraná",
+	"PE": "Pernambuco",
+	"PI": "Piauí",
+	"RJ": "Rio de Janeiro",
+	"RN": "Rio Grande do Norte",
+	"RS": "Rio Grande do Sul",
+	"RO": "Rondônia",
+	"RR": "Roraima",
+	"SC": "Santa Catarina",
+	"SP": "São Paulo",
+	"SE": "Sergipe",
+	"TO": "Tocantins",
+}
+
+// matchesState reports whether a region returned by a provider, either the
+// state name or its UF, is the state of the location. Unknown states and
+// empty regions match, as there is nothing to compare.
+func (l WeatherLocation) matchesState(region string) bool {
+	name, ok := brazilianStates[l.State]
+	if !ok || region == "" {
+		return true
+	}
+	region = normalizeLocation(region)
+	return region == normalizeLocation(name) || region == normalizeLocation(l.State)
+}
+
+// validate checks the weather returned by a provider is from the requested
+// state and country, returning ErrLocationMismatch otherwise.
+func (l WeatherLocation) validate(ctx context.Context, provider string, weather *WeatherAPIResponse) error {
+	switch normalizeLocation(weather.Location.Country) {
+	case "", "brazil", "brasil", "br":
+		if l.matchesState(weather.Location.Region) {
+			return nil
+		}
+	}
+	logging.Logger.WarnContext(ctx, "Weather location does not match the requested one",
+		"provider", provider,
+		"state", l.State,
+		"region", weather.Location.Region,
+		"country", weather.Location.Country,
+	)
+	return ErrLocationMismatch
+}
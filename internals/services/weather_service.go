@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/internals"
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+)
+
+type WeatherService interface {
+	GetWeather(ctx context.Context, location WeatherLocation) (*WeatherAPIResponse, error)
+}
+
+// Weather providers available to WEATHER_PROVIDERS
+const (
+	WeatherProviderWeatherAPI     = "weatherapi"
+	WeatherProviderOpenMeteo      = "openmeteo"
+	WeatherProviderOpenWeatherMap = "openweathermap"
+)
+
+// WeatherProvidersConfig configures which weather providers are used.
+type WeatherProvidersConfig struct {
+	// Providers are tried in this order.
+	Providers []string
+	// Timeout bounds each provider attempt.
+	Timeout time.Duration
+	// WeatherAPIKeys are the WeatherAPI.com keys.
+	WeatherAPIKeys WeatherAPIKeysConfig
+	// OpenWeatherMapAPIKey is the OpenWeatherMap key.
+	OpenWeatherMapAPIKey string `secret:"true"`
+}
+
+// WeatherProvidersConfigFromEnv reads the weather providers settings from
+// WEATHER_PROVIDERS, WEATHER_PROVIDER_TIMEOUT and OPENWEATHERMAP_API_KEY, the
+// WeatherAPI keys are read by WeatherAPIKeysConfigFromEnv.
+func WeatherProvidersConfigFromEnv(env environment.Source) WeatherProvidersConfig {
+	var providers []string
+	for _, provider := range strings.Split(env.GetEnvOrDefault("WEATHER_PROVIDERS", WeatherProviderWeatherAPI), ",") {
+		if provider = strings.ToLower(strings.TrimSpace(provider)); provider != "" {
+			providers = append(providers, provider)
+		}
+	}
+	return WeatherProvidersConfig{
+		Providers:            providers,
+		Timeout:              env.GetDurationOrDefault("WEATHER_PROVIDER_TIMEOUT", 5*time.Second),
+		WeatherAPIKeys:       WeatherAPIKeysConfigFromEnv(env),
+		OpenWeatherMapAPIKey: env.GetEnvOrDefault("OPENWEATHERMAP_API_KEY", ""),
+	}
+}
+
+// NewWeatherService creates the WeatherService querying the configured
+// providers, failing over between them when more than one is set. WeatherAPI
+// rotates the keys of the pool.
+func NewWeatherService(config WeatherProvidersConfig, keys *WeatherAPIKeyPool, upstreams internals.UpstreamsConfig) WeatherService {
+	var providers []NamedWeatherService
+	for _, name := range config.Providers {
+		var provider WeatherService
+		switch name {
+		case WeatherProviderWeatherAPI:
+			provider = NewWeatherAPIService(keys, upstreams)
+		case WeatherProviderOpenMeteo:
+			provider = NewOpenMeteoService(upstreams)
+		case WeatherProviderOpenWeatherMap:
+			provider = NewOpenWeatherMapService(config.OpenWeatherMapAPIKey, upstreams)
+		default:
+			logging.Logger.Error("Unknown weather provider, ignoring it", "provider", name)
+			continue
+		}
+		providers = append(providers, NamedWeatherService{Name: name, WeatherService: provider})
+	}
+	switch len(providers) {
+	case 0:
+		logging.Logger.Error("No valid weather provider configured, using WeatherAPI")
+		return NewWeatherAPIService(keys, upstreams)
+	case 1:
+		return providers[0].WeatherService
+	default:
+		return NewFallbackWeatherService(providers, config.Timeout)
+	}
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c WeatherProvidersConfig) Validate() error {
+	var errs []error
+	if len(c.Providers) == 0 {
+		errs = append(errs, errors.New("WEATHER_PROVIDERS must list at least one provider"))
+	}
+	for _, provider := range c.Providers {
+		switch provider {
+		case WeatherProviderWeatherAPI:
+			errs = append(errs, c.WeatherAPIKeys.Validate())
+		case WeatherProviderOpenMeteo:
+		case WeatherProviderOpenWeatherMap:
+			if c.OpenWeatherMapAPIKey == "" {
+				errs = append(errs, errors.New("OPENWEATHERMAP_API_KEY is required by the openweathermap provider"))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("WEATHER_PROVIDERS has an unknown provider %q", provider))
+		}
+	}
+	if c.Timeout <= 0 {
+		errs = append(errs, errors.New("WEATHER_PROVIDER_TIMEOUT must be positive"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,54 @@
+package internals
+
+import (
+	"errors"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+)
+
+// UpstreamsConfig configures the calls to the upstream services.
+type UpstreamsConfig struct {
+	Retry          RetryConfig
+	CircuitBreaker CircuitBreakerConfig
+	// HTTPClients are the HTTP_CLIENT_* settings of each upstream called.
+	HTTPClients []HTTPClientConfig
+}
+
+// UpstreamsConfigFromEnv reads the retry and circuit breaker settings, along
+// with the HTTP client settings of each given upstream.
+func UpstreamsConfigFromEnv(env environment.Source, upstreams ...string) UpstreamsConfig {
+	clients := make([]HTTPClientConfig, 0, len(upstreams))
+	for _, upstream := range upstreams {
+		clients = append(clients, HTTPClientConfigFromEnv(env, upstream))
+	}
+	return UpstreamsConfig{
+		Retry:          RetryConfigFromEnv(env),
+		CircuitBreaker: CircuitBreakerConfigFromEnv(env),
+		HTTPClients:    clients,
+	}
+}
+
+// HTTPClient returns the HTTP client settings of upstream. An upstream not
+// read by UpstreamsConfigFromEnv gets the defaults.
+func (c UpstreamsConfig) HTTPClient(upstream string) HTTPClientConfig {
+	for _, client := range c.HTTPClients {
+		if client.Upstream == upstream {
+			return client
+		}
+	}
+	return HTTPClientConfigFromEnv(environment.NewSource(noSettings, nil), upstream)
+}
+
+// noSettings is a lookup where nothing is set
+func noSettings(string) (string, bool) {
+	return "", false
+}
+
+// Validate checks the settings, returning all the invalid ones
+func (c UpstreamsConfig) Validate() error {
+	errs := []error{c.Retry.Validate(), c.CircuitBreaker.Validate()}
+	for _, client := range c.HTTPClients {
+		errs = append(errs, client.Validate())
+	}
+	return errors.Join(errs...)
+}
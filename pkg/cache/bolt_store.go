@@ -0,0 +1,297 @@
+package cache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltSchemaVersion is the layout of the entries written by BoltStore. Files
+// written with another version are discarded when opened.
+const BoltSchemaVersion = 1
+
+var (
+	boltEntriesBucket = []byte("entries")
+	boltMetaBucket    = []byte("meta")
+	boltSchemaKey     = []byte("schema_version")
+)
+
+// BoltStore is a Store persisted on disk using bbolt, so entries survive
+// restarts. It holds up to maxEntries entries, evicting the ones expiring
+// first, and a background compaction removes the expired entries and
+// rewrites the file to release the space they used.
+type BoltStore struct {
+	path       string
+	maxEntries int
+
+	// mu guards db, which is replaced when the file is rewritten
+	mu      sync.RWMutex
+	db      *bolt.DB
+	entries int
+
+	done      chan struct{}
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// NewBoltStore opens (or creates) the store at path, holding up to
+// maxEntries entries (0 means unbounded) and compacting it every
+// compactionInterval.
+func NewBoltStore(path string, maxEntries int, compactionInterval time.Duration) (*BoltStore, error) {
+	db, err := openBolt(path)
+	if err != nil {
+		return nil, err
+	}
+	s := &BoltStore{path: path, maxEntries: maxEntries, db: db, done: make(chan struct{})}
+	if err := db.View(func(tx *bolt.Tx) error {
+		s.entries = tx.Bucket(boltEntriesBucket).Stats().KeyN
+		return nil
+	}); err != nil {
+		return nil, errors.Join(err, db.Close())
+	}
+	if compactionInterval > 0 {
+		s.wg.Add(1)
+		go s.compactLoop(compactionInterval)
+	}
+	return s, nil
+}
+
+func openBolt(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cache file %s: %w", path, err)
+	}
+	if err := db.Update(migrateBoltSchema); err != nil {
+		return nil, errors.Join(fmt.Errorf("failed to initialize cache file %s: %w", path, err), db.Close())
+	}
+	return db, nil
+}
+
+// migrateBoltSchema records the schema version, dropping the entries written
+// by other versions.
+func migrateBoltSchema(tx *bolt.Tx) error {
+	meta, err := tx.CreateBucketIfNotExists(boltMetaBucket)
+	if err != nil {
+		return err
+	}
+	version := make([]byte, 8)
+	binary.BigEndian.PutUint64(version, BoltSchemaVersion)
+	if current := meta.Get(boltSchemaKey); current != nil && string(current) != string(version) {
+		if err := tx.DeleteBucket(boltEntriesBucket); err != nil && !errors.Is(err, bolt.ErrBucketNotFound) {
+			return err
+		}
+	}
+	if _, err := tx.CreateBucketIfNotExists(boltEntriesBucket); err != nil {
+		return err
+	}
+	return meta.Put(boltSchemaKey, version)
+}
+
+func (s *BoltStore) Get(key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var value []byte
+	var found bool
+	err := s.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket(boltEntriesBucket).Get([]byte(key))
+		data, expired, err := decodeBoltEntry(raw)
+		if raw == nil || expired || err != nil {
+			return err
+		}
+		// The slice is only valid during the transaction
+		value = append([]byte(nil), data...)
+		found = true
+		return nil
+	})
+	return value, found, err
+}
+
+func (s *BoltStore) Set(key string, value []byte, ttl time.Duration) error {
+	entry := make([]byte, 8+len(value))
+	binary.BigEndian.PutUint64(entry, uint64(time.Now().Add(ttl).UnixNano()))
+	copy(entry[8:], value)
+
+	// The entries are counted by the writers, which hold the write lock. The
+	// count is only updated once the transaction is committed.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entries := s.entries
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEntriesBucket)
+		if bucket.Get([]byte(key)) == nil {
+			entries++
+		}
+		if err := bucket.Put([]byte(key), entry); err != nil {
+			return err
+		}
+		if s.maxEntries > 0 && entries > s.maxEntries {
+			var err error
+			entries, err = s.evict(bucket, entries)
+			return err
+		}
+		return nil
+	})
+	if err == nil {
+		s.entries = entries
+	}
+	return err
+}
+
+func (s *BoltStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	deleted := false
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(boltEntriesBucket)
+		if bucket.Get([]byte(key)) == nil {
+			return nil
+		}
+		deleted = true
+		return bucket.Delete([]byte(key))
+	})
+	if err == nil && deleted {
+		s.entries--
+	}
+	return err
+}
+
+// evict removes the expired entries and then the ones expiring first, down
+// to 90% of maxEntries so it does not run on every Set. It returns the
+// amount of entries left out of the given ones.
+func (s *BoltStore) evict(bucket *bolt.Bucket, entries int) (int, error) {
+	type candidate struct {
+		key       []byte
+		expiresAt int64
+	}
+	var candidates []candidate
+	cursor := bucket.Cursor()
+	for key, raw := cursor.First(); key != nil; key, raw = cursor.Next() {
+		if _, expired, err := decodeBoltEntry(raw); expired || err != nil {
+			if err := cursor.Delete(); err != nil {
+				return entries, err
+			}
+			entries--
+			continue
+		}
+		candidates = append(candidates, candidate{
+			key:       append([]byte(nil), key...),
+			expiresAt: int64(binary.BigEndian.Uint64(raw)),
+		})
+	}
+	target := s.maxEntries * 9 / 10
+	if entries <= target {
+		return entries, nil
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].expiresAt < candidates[j].expiresAt })
+	// The count may be off the bucket, e.g. after a failed compaction
+	n := min(len(candidates), entries-target)
+	for _, c := range candidates[:n] {
+		if err := bucket.Delete(c.key); err != nil {
+			return entries, err
+		}
+	}
+	return len(candidates) - n, nil
+}
+
+// Compact removes the expired entries and rewrites the file, as bbolt does
+// not shrink it when entries are deleted. It returns the amount of entries
+// removed.
+func (s *BoltStore) Compact() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(boltEntriesBucket).Cursor()
+		for key, raw := cursor.First(); key != nil; key, raw = cursor.Next() {
+			if _, expired, err := decodeBoltEntry(raw); expired || err != nil {
+				if err := cursor.Delete(); err != nil {
+					return err
+				}
+				removed++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	rewriteErr := s.rewrite()
+	// The count is refreshed from the file, whether it was rewritten or not
+	return removed, errors.Join(rewriteErr, s.db.View(func(tx *bolt.Tx) error {
+		s.entries = tx.Bucket(boltEntriesBucket).Stats().KeyN
+		return nil
+	}))
+}
+
+// rewrite copies the live pages to a new file replacing the current one.
+// The current file is kept open until the new one replaces it, so a failure
+// leaves the store usable. The caller must hold the write lock.
+func (s *BoltStore) rewrite() error {
+	tmpPath := s.path + ".compact"
+	dst, err := bolt.Open(tmpPath, 0o600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return fmt.Errorf("failed to create compacted cache file: %w", err)
+	}
+	if err := bolt.Compact(dst, s.db, 0); err != nil {
+		return errors.Join(fmt.Errorf("failed to compact cache file: %w", err), dst.Close(), os.Remove(tmpPath))
+	}
+	// The open handle follows the file once renamed
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return errors.Join(err, dst.Close(), os.Remove(tmpPath))
+	}
+	old := s.db
+	s.db = dst
+	return old.Close()
+}
+
+func (s *BoltStore) compactLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			removed, err := s.Compact()
+			if err != nil {
+				logging.Logger.Warn("Error compacting cache file", "error", err)
+				continue
+			}
+			logging.Logger.Debug("Compacted cache file", "removed", removed)
+		}
+	}
+}
+
+// Close stops the compaction and closes the file, it is safe to call more
+// than once.
+func (s *BoltStore) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.wg.Wait()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closeErr = s.db.Close()
+	})
+	return s.closeErr
+}
+
+// decodeBoltEntry splits the expiration prefix from the stored value.
+func decodeBoltEntry(raw []byte) ([]byte, bool, error) {
+	if raw == nil {
+		return nil, false, nil
+	}
+	if len(raw) < 8 {
+		return nil, true, errors.New("corrupted cache entry")
+	}
+	expiresAt := time.Unix(0, int64(binary.BigEndian.Uint64(raw)))
+	return raw[8:], time.Now().After(expiresAt), nil
+}
@@ -0,0 +1,44 @@
+package cache
+
+import "time"
+
+// Store persists serialized cache entries, each one expiring after its TTL.
+type Store interface {
+	// Get returns the value stored for key, if it has not expired yet.
+	Get(key string) ([]byte, bool, error)
+	// Set stores value for key during ttl.
+	Set(key string, value []byte, ttl time.Duration) error
+	// Delete removes key from the store.
+	Delete(key string) error
+	// Close releases the resources held by the store.
+	Close() error
+}
+
+// MemoryStore is a Store kept in a size bounded in-memory LRU.
+type MemoryStore struct {
+	lru *LRU[string, []byte]
+}
+
+// NewMemoryStore creates a MemoryStore holding up to size entries.
+func NewMemoryStore(size int) *MemoryStore {
+	return &MemoryStore{lru: NewLRU[string, []byte](size)}
+}
+
+func (m *MemoryStore) Get(key string) ([]byte, bool, error) {
+	value, ok := m.lru.Get(key)
+	return value, ok, nil
+}
+
+func (m *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	m.lru.Set(key, value, ttl)
+	return nil
+}
+
+func (m *MemoryStore) Delete(key string) error {
+	m.lru.Delete(key)
+	return nil
+}
+
+func (m *MemoryStore) Close() error {
+	return nil
+}
@@ -1,11 +1,139 @@
 package environment
 
-import "os"
+import (
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
 
-func GetEnvOrDefault(key, fallback string) string {
-	value := os.Getenv(key)
+// Source reads the settings, e.g. the environment layered with a
+// configuration file and command line flags.
+type Source struct {
+	lookup func(key string) (string, bool)
+	// invalid is called for every value that can not be parsed
+	invalid func(key, value string, fallback any, err error)
+}
+
+// NewSource creates a Source reading the settings from lookup, os.LookupEnv
+// when nil. The values that can not be parsed are reported to invalid, or
+// logged when nil, and the fallback is returned in their place.
+func NewSource(lookup func(key string) (string, bool), invalid func(key, value string, fallback any, err error)) Source {
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	if invalid == nil {
+		invalid = logInvalid
+	}
+	return Source{lookup: lookup, invalid: invalid}
+}
+
+// OS reads the settings from the process environment
+var OS = NewSource(nil, nil)
+
+// logInvalid logs through the default slog logger, so it works before the
+// application logger is set up
+func logInvalid(key, value string, fallback any, err error) {
+	slog.Default().Warn("invalid value, using default", "key", key, "default", fallback, "error", err)
+}
+
+// Lookup returns the value set on key and whether it is set
+func (s Source) Lookup(key string) (string, bool) {
+	return s.lookup(key)
+}
+
+// GetEnvOrDefault returns the value set on key, or fallback when it is not
+// set or empty.
+func (s Source) GetEnvOrDefault(key, fallback string) string {
+	value, _ := s.lookup(key)
 	if len(value) == 0 {
 		return fallback
 	}
 	return value
 }
+
+// GetIntOrDefault returns the integer set on key, or fallback when it is not
+// set or invalid.
+func (s Source) GetIntOrDefault(key string, fallback int) int {
+	value, _ := s.lookup(key)
+	if len(value) == 0 {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		s.invalid(key, value, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// GetDurationOrDefault returns the duration (e.g. "30s", "24h") set on key, or
+// fallback when it is not set or invalid.
+func (s Source) GetDurationOrDefault(key string, fallback time.Duration) time.Duration {
+	value, _ := s.lookup(key)
+	if len(value) == 0 {
+		return fallback
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		s.invalid(key, value, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// GetBoolOrDefault returns the boolean (e.g. "true", "0") set on key, or
+// fallback when it is not set or invalid.
+func (s Source) GetBoolOrDefault(key string, fallback bool) bool {
+	value, _ := s.lookup(key)
+	if len(value) == 0 {
+		return fallback
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		s.invalid(key, value, fallback, err)
+		return fallback
+	}
+	return parsed
+}
+
+// GetListOrDefault returns the comma separated list set on key, or fallback
+// when it is not set. Set but empty means an empty list.
+func (s Source) GetListOrDefault(key string, fallback []string) []string {
+	value, ok := s.lookup(key)
+	if !ok {
+		return fallback
+	}
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// GetEnvOrDefault reads a value from the process environment, see
+// Source.GetEnvOrDefault.
+func GetEnvOrDefault(key, fallback string) string {
+	return OS.GetEnvOrDefault(key, fallback)
+}
+
+// GetIntOrDefault reads an integer from the process environment, see
+// Source.GetIntOrDefault.
+func GetIntOrDefault(key string, fallback int) int {
+	return OS.GetIntOrDefault(key, fallback)
+}
+
+// GetDurationOrDefault reads a duration from the process environment, see
+// Source.GetDurationOrDefault.
+func GetDurationOrDefault(key string, fallback time.Duration) time.Duration {
+	return OS.GetDurationOrDefault(key, fallback)
+}
+
+// GetBoolOrDefault reads a boolean from the process environment, see
+// Source.GetBoolOrDefault.
+func GetBoolOrDefault(key string, fallback bool) bool {
+	return OS.GetBoolOrDefault(key, fallback)
+}
@@ -0,0 +1,57 @@
+// Package filewatch polls files for changes, such as secrets mounted by
+// Kubernetes or Docker which are replaced through symlinks.
+package filewatch
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+)
+
+// Watch calls onChange every time the content of path changes, checking it
+// every interval until ctx is done. Polling the content, instead of relying
+// on file system events, also detects the symlink swaps of mounted secrets.
+// A file that can not be read is only logged when it stops or starts being
+// readable again, not on every check.
+func Watch(ctx context.Context, path string, interval time.Duration, onChange func()) {
+	last, err := checksum(path)
+	readable := err == nil
+	ticker := time.NewTicker(interval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			current, err := checksum(path)
+			if err != nil {
+				if readable {
+					readable = false
+					logging.Logger.WarnContext(ctx, "Error reading watched file", "path", path, "error", err)
+				}
+				continue
+			}
+			if !readable {
+				readable = true
+				logging.Logger.InfoContext(ctx, "Watched file readable again", "path", path)
+			}
+			if current != last {
+				last = current
+				onChange()
+			}
+		}
+	}()
+}
+
+func checksum(path string) ([sha256.Size]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(content), nil
+}
@@ -0,0 +1,68 @@
+// Package telemetrytest provides in-memory exporters for the tests of the
+// packages exporting telemetry.
+package telemetrytest
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+// LogExporter is a log exporter keeping the exported records in memory.
+type LogExporter struct {
+	mu       sync.Mutex
+	records  []sdklog.Record
+	shutdown bool
+}
+
+func (e *LogExporter) Export(_ context.Context, records []sdklog.Record) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, record := range records {
+		e.records = append(e.records, record.Clone())
+	}
+	return nil
+}
+
+func (e *LogExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *LogExporter) Shutdown(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+// Len returns the amount of records exported
+func (e *LogExporter) Len() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.records)
+}
+
+// IsShutdown tells whether the exporter was shut down
+func (e *LogExporter) IsShutdown() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.shutdown
+}
+
+// Text returns the exported records one per line, each with its body
+// followed by its key=value attributes.
+func (e *LogExporter) Text() string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	lines := make([]string, 0, len(e.records))
+	for _, record := range e.records {
+		text := []string{record.Body().String()}
+		record.WalkAttributes(func(kv log.KeyValue) bool {
+			text = append(text, kv.Key+"="+kv.Value.String())
+			return true
+		})
+		lines = append(lines, strings.Join(text, " "))
+	}
+	return strings.Join(lines, "\n")
+}
@@ -4,17 +4,28 @@ import (
 	"log"
 	"log/slog"
 	"os"
+
+	"go.opentelemetry.io/contrib/bridges/otelslog"
 )
 
+const instrumentationName = "github.com/rcbadiale/go_open_telemetry/pkg/logging"
+
 var Logger *slog.Logger
 
+// SetupLogger writes JSON logs to stdout and bridges them to the global
+// OpenTelemetry LoggerProvider, which is set by telemetry.InitProvider. The
+// secrets are redacted from both. It also becomes the slog default logger.
 func SetupLogger() *log.Logger {
-	loggerHandler := slog.NewJSONHandler(
-		os.Stdout,
-		&slog.HandlerOptions{
-			AddSource: true,
-		},
-	)
+	loggerHandler := newRedactHandler(newFanoutHandler(
+		NewTraceHandler(slog.NewJSONHandler(
+			os.Stdout,
+			&slog.HandlerOptions{
+				AddSource: true,
+			},
+		)),
+		otelslog.NewHandler(instrumentationName),
+	))
 	Logger = slog.New(loggerHandler)
+	slog.SetDefault(Logger)
 	return slog.NewLogLogger(loggerHandler, slog.LevelInfo)
 }
@@ -0,0 +1,73 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/redact"
+)
+
+// redactHandler removes the secrets, such as API keys in URLs, from the
+// message and the attributes before they reach the wrapped handler.
+type redactHandler struct {
+	handler slog.Handler
+}
+
+func newRedactHandler(handler slog.Handler) slog.Handler {
+	return &redactHandler{handler: handler}
+}
+
+func (h *redactHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+func (h *redactHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, redact.String(record.Message), record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		redacted.AddAttrs(redactAttr(attr))
+		return true
+	})
+	return h.handler.Handle(ctx, redacted)
+}
+
+func (h *redactHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		redacted = append(redacted, redactAttr(attr))
+	}
+	return &redactHandler{handler: h.handler.WithAttrs(redacted)}
+}
+
+func (h *redactHandler) WithGroup(name string) slog.Handler {
+	return &redactHandler{handler: h.handler.WithGroup(name)}
+}
+
+// redactAttr redacts the strings, errors and any other value formatted as a
+// string, as well as the sensitive headers.
+func redactAttr(attr slog.Attr) slog.Attr {
+	if redact.Header(attr.Key) {
+		return slog.String(attr.Key, redact.Replacement)
+	}
+	value := attr.Value.Resolve()
+	switch value.Kind() {
+	case slog.KindString:
+		return slog.String(attr.Key, redact.String(value.String()))
+	case slog.KindGroup:
+		group := value.Group()
+		redacted := make([]any, 0, len(group))
+		for _, member := range group {
+			redacted = append(redacted, redactAttr(member))
+		}
+		return slog.Group(attr.Key, redacted...)
+	case slog.KindAny:
+		if err, ok := value.Any().(error); ok {
+			return slog.String(attr.Key, redact.String(redact.Error(err).Error()))
+		}
+		if formatted := value.String(); redact.String(formatted) != formatted {
+			return slog.String(attr.Key, redact.String(formatted))
+		}
+		return slog.Attr{Key: attr.Key, Value: value}
+	default:
+		return slog.Attr{Key: attr.Key, Value: value}
+	}
+}
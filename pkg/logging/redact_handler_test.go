@@ -0,0 +1,128 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/internal/telemetrytest"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+)
+
+const testSecret = "s3cr3t-api-key"
+
+// captureStdout runs fn with os.Stdout redirected, returning what it wrote
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		data, _ := io.ReadAll(r)
+		output <- string(data)
+	}()
+	fn()
+	w.Close()
+	return <-output
+}
+
+func TestSetupLoggerRedactsSecrets(t *testing.T) {
+	secretURL := "https://api.weatherapi.com/v1/current.json?q=Sao+Paulo&key=" + testSecret
+	tests := []struct {
+		name string
+		log  func(logger *slog.Logger)
+		// wantKept is part of the output that must not be redacted
+		wantKept string
+	}{
+		{
+			name:     "message",
+			log:      func(logger *slog.Logger) { logger.Info("requesting " + secretURL) },
+			wantKept: "requesting",
+		},
+		{
+			name:     "string attribute",
+			log:      func(logger *slog.Logger) { logger.Info("request", "url", secretURL) },
+			wantKept: "Sao+Paulo",
+		},
+		{
+			name: "url error",
+			log: func(logger *slog.Logger) {
+				logger.Error("request failed", "error", &url.Error{Op: "Get", URL: secretURL, Err: errors.New("timeout")})
+			},
+			wantKept: "timeout",
+		},
+		{
+			name: "wrapped error",
+			log: func(logger *slog.Logger) {
+				err := &url.Error{Op: "Get", URL: secretURL, Err: errors.New("timeout")}
+				logger.Error("request failed", "error", errors.Join(errors.New("upstream"), err))
+			},
+			wantKept: "upstream",
+		},
+		{
+			name:     "sensitive header",
+			log:      func(logger *slog.Logger) { logger.Info("request", "X-Api-Key", testSecret) },
+			wantKept: "X-Api-Key",
+		},
+		{
+			name: "group",
+			log: func(logger *slog.Logger) {
+				logger.Info("request", slog.Group("http", "url", secretURL, "authorization", "Bearer "+testSecret))
+			},
+			wantKept: "http",
+		},
+		{
+			name: "stringer",
+			log: func(logger *slog.Logger) {
+				parsed, _ := url.Parse(secretURL)
+				logger.Info("request", "url", parsed)
+			},
+			wantKept: "api.weatherapi.com",
+		},
+		{
+			name:     "logger attributes",
+			log:      func(logger *slog.Logger) { logger.With("url", secretURL).WithGroup("g").Info("request") },
+			wantKept: "api.weatherapi.com",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporter := &telemetrytest.LogExporter{}
+			provider := sdklog.NewLoggerProvider(sdklog.WithProcessor(sdklog.NewSimpleProcessor(exporter)))
+			previous := global.GetLoggerProvider()
+			global.SetLoggerProvider(provider)
+			defer global.SetLoggerProvider(previous)
+
+			stdout := captureStdout(t, func() {
+				SetupLogger()
+				tt.log(Logger)
+			})
+			if err := provider.Shutdown(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+
+			for name, output := range map[string]string{"stdout": stdout, "OTLP": exporter.Text()} {
+				if output == "" {
+					t.Errorf("nothing written to %s", name)
+				}
+				if strings.Contains(output, testSecret) {
+					t.Errorf("the secret reached %s: %s", name, output)
+				}
+				if !strings.Contains(output, tt.wantKept) {
+					t.Errorf("%s lost %q: %s", name, tt.wantKept, output)
+				}
+			}
+		})
+	}
+}
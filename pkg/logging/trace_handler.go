@@ -0,0 +1,39 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceHandler decorates a slog.Handler adding the trace_id, span_id and
+// trace_flags of the span found in the record context.
+type TraceHandler struct {
+	slog.Handler
+}
+
+// NewTraceHandler wraps the given handler with trace correlation attributes.
+func NewTraceHandler(handler slog.Handler) *TraceHandler {
+	return &TraceHandler{Handler: handler}
+}
+
+func (t *TraceHandler) Handle(ctx context.Context, record slog.Record) error {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if spanContext.IsValid() {
+		record.AddAttrs(
+			slog.String("trace_id", spanContext.TraceID().String()),
+			slog.String("span_id", spanContext.SpanID().String()),
+			slog.String("trace_flags", spanContext.TraceFlags().String()),
+		)
+	}
+	return t.Handler.Handle(ctx, record)
+}
+
+func (t *TraceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return NewTraceHandler(t.Handler.WithAttrs(attrs))
+}
+
+func (t *TraceHandler) WithGroup(name string) slog.Handler {
+	return NewTraceHandler(t.Handler.WithGroup(name))
+}
@@ -0,0 +1,172 @@
+// Package redact hides secrets, such as API keys sent as query parameters,
+// from the logs, errors and span attributes.
+package redact
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync/atomic"
+)
+
+// Replacement is written in place of the redacted values
+const Replacement = "REDACTED"
+
+var (
+	// DefaultQueryParams are the query parameters redacted when
+	// REDACT_QUERY_PARAMS is not set.
+	DefaultQueryParams = []string{"key", "appid", "api_key", "apikey", "token", "access_token"}
+	// DefaultHeaders are the headers redacted when REDACT_HEADERS is not set.
+	DefaultHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+)
+
+// Redactor redacts the configured query parameters and headers.
+type Redactor struct {
+	queryParams map[string]struct{}
+	headers     map[string]struct{}
+	// pattern finds the sensitive query parameters in free text, such as
+	// error messages including an URL.
+	pattern *regexp.Regexp
+}
+
+// New creates a Redactor for the given query parameters and headers, both
+// case insensitive
+func New(queryParams, headers []string) *Redactor {
+	r := &Redactor{
+		queryParams: make(map[string]struct{}, len(queryParams)),
+		headers:     make(map[string]struct{}, len(headers)),
+	}
+	quoted := make([]string, 0, len(queryParams))
+	for _, param := range queryParams {
+		r.queryParams[strings.ToLower(param)] = struct{}{}
+		quoted = append(quoted, regexp.QuoteMeta(param))
+	}
+	for _, header := range headers {
+		r.headers[http.CanonicalHeaderKey(header)] = struct{}{}
+	}
+	if len(quoted) > 0 {
+		r.pattern = regexp.MustCompile(`(?i)([?&;](?:` + strings.Join(quoted, "|") + `)=)[^&;#\s"'\\]*`)
+	}
+	return r
+}
+
+// NewFromEnv creates a Redactor for the comma separated query parameters and
+// headers set on REDACT_QUERY_PARAMS and REDACT_HEADERS.
+func NewFromEnv() *Redactor {
+	return New(
+		listFromEnv("REDACT_QUERY_PARAMS", DefaultQueryParams),
+		listFromEnv("REDACT_HEADERS", DefaultHeaders),
+	)
+}
+
+func listFromEnv(key string, fallback []string) []string {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// URL redacts the sensitive query parameters and the password of an URL
+func (r *Redactor) URL(raw string) string {
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return r.String(raw)
+	}
+	if _, ok := parsed.User.Password(); ok {
+		parsed.User = url.UserPassword(parsed.User.Username(), Replacement)
+	}
+	query := parsed.Query()
+	redacted := false
+	for param := range query {
+		if _, ok := r.queryParams[strings.ToLower(param)]; ok {
+			query[param] = []string{Replacement}
+			redacted = true
+		}
+	}
+	if redacted {
+		parsed.RawQuery = query.Encode()
+	}
+	return parsed.String()
+}
+
+// String redacts the sensitive query parameters found in a text
+func (r *Redactor) String(s string) string {
+	if r.pattern == nil {
+		return s
+	}
+	return r.pattern.ReplaceAllString(s, "${1}"+Replacement)
+}
+
+// Header reports whether the header is sensitive
+func (r *Redactor) Header(name string) bool {
+	_, ok := r.headers[http.CanonicalHeaderKey(name)]
+	return ok
+}
+
+// Error redacts the URL of an *url.Error, keeping the error it wraps so it
+// can still be matched by errors.Is. When the *url.Error is wrapped, the
+// message of the whole chain is redacted.
+func (r *Redactor) Error(err error) error {
+	var urlErr *url.Error
+	if err == nil || !errors.As(err, &urlErr) {
+		return err
+	}
+	redacted := r.URL(urlErr.URL)
+	if redacted == urlErr.URL {
+		return err
+	}
+	if err == error(urlErr) {
+		return &url.Error{Op: urlErr.Op, URL: redacted, Err: urlErr.Err}
+	}
+	message := strings.ReplaceAll(err.Error(), urlErr.URL, redacted)
+	return &redactedError{message: r.String(message), err: err}
+}
+
+// redactedError replaces the message of an error chain holding a secret
+type redactedError struct {
+	message string
+	err     error
+}
+
+func (e *redactedError) Error() string { return e.message }
+
+func (e *redactedError) Unwrap() error { return e.err }
+
+var defaultRedactor atomic.Pointer[Redactor]
+
+func init() {
+	defaultRedactor.Store(NewFromEnv())
+}
+
+// Default returns the Redactor used by the package functions
+func Default() *Redactor {
+	return defaultRedactor.Load()
+}
+
+// SetDefault replaces the Redactor used by the package functions, e.g. after
+// loading a .env file
+func SetDefault(r *Redactor) {
+	defaultRedactor.Store(r)
+}
+
+// URL redacts an URL using the default Redactor
+func URL(raw string) string { return Default().URL(raw) }
+
+// String redacts a text using the default Redactor
+func String(s string) string { return Default().String(s) }
+
+// Header reports whether the header is sensitive for the default Redactor
+func Header(name string) bool { return Default().Header(name) }
+
+// Error redacts an error using the default Redactor
+func Error(err error) error { return Default().Error(err) }
@@ -0,0 +1,198 @@
+package telemetry
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/environment"
+)
+
+// Config configures how the telemetry is described, sampled, propagated and
+// exported.
+type Config struct {
+	// ServiceName replaces the service name given to InitProvider when set,
+	// OTEL_SERVICE_NAME.
+	ServiceName string
+	// ServiceVersion is SERVICE_VERSION, the build info version when empty.
+	ServiceVersion string
+	// DeploymentEnvironment is DEPLOYMENT_ENVIRONMENT.
+	DeploymentEnvironment string
+	// ResourceAttributes are added to the resource, taking precedence over
+	// the detected ones, OTEL_RESOURCE_ATTRIBUTES (e.g. "team=a,region=b").
+	ResourceAttributes string
+	// Exporter is the exporter set, TELEMETRY_EXPORTER.
+	Exporter string
+	// Endpoint is the collector address, OTEL_EXPORTER_OTLP_ENDPOINT. Empty
+	// uses the default port of each signal protocol, 4317 for grpc and 4318
+	// for http/protobuf. OTEL_EXPORTER_OTLP_<SIGNAL>_ENDPOINT replaces it for
+	// a single signal.
+	Endpoint        string
+	TracesEndpoint  string
+	MetricsEndpoint string
+	LogsEndpoint    string
+	// Protocol is the OTLP protocol, OTEL_EXPORTER_OTLP_PROTOCOL, replaced for
+	// a single signal by OTEL_EXPORTER_OTLP_<SIGNAL>_PROTOCOL.
+	Protocol        string
+	TracesProtocol  string
+	MetricsProtocol string
+	LogsProtocol    string
+	// Headers are sent to the collector, OTEL_EXPORTER_OTLP_HEADERS, along
+	// with OTEL_EXPORTER_OTLP_<SIGNAL>_HEADERS for a single signal.
+	Headers        string `secret:"true"`
+	TracesHeaders  string `secret:"true"`
+	MetricsHeaders string `secret:"true"`
+	LogsHeaders    string `secret:"true"`
+	// Insecure forces plaintext when "true" or TLS when "false",
+	// OTEL_EXPORTER_OTLP_INSECURE. Empty follows the endpoint scheme.
+	Insecure string
+	// Certificate, ClientCertificate and ClientKey are the PEM files of the
+	// collector CA and of the mTLS key pair, OTEL_EXPORTER_OTLP_CERTIFICATE,
+	// OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE and OTEL_EXPORTER_OTLP_CLIENT_KEY.
+	Certificate       string
+	ClientCertificate string
+	ClientKey         string
+	// TLSServerName is OTEL_EXPORTER_OTLP_TLS_SERVER_NAME.
+	TLSServerName string
+	// Fallback is the exporter used while the collector is unreachable,
+	// OTEL_EXPORTER_OTLP_FALLBACK.
+	Fallback string
+	// Sampler and SamplerArg are OTEL_TRACES_SAMPLER and
+	// OTEL_TRACES_SAMPLER_ARG.
+	Sampler    string
+	SamplerArg string
+	// SamplerKeepErrors and SamplerKeepRoutes are
+	// OTEL_TRACES_SAMPLER_KEEP_ERRORS and OTEL_TRACES_SAMPLER_KEEP_ROUTES.
+	SamplerKeepErrors bool
+	SamplerKeepRoutes []string
+	// Propagators are OTEL_PROPAGATORS, tracecontext and baggage when empty.
+	Propagators []string
+}
+
+// ConfigFromEnv reads the telemetry settings from the variables listed on
+// each Config field.
+func ConfigFromEnv(env environment.Source) Config {
+	protocol := env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_PROTOCOL", ProtocolGRPC)
+	return Config{
+		ServiceName:           env.GetEnvOrDefault("OTEL_SERVICE_NAME", ""),
+		ServiceVersion:        env.GetEnvOrDefault("SERVICE_VERSION", ""),
+		DeploymentEnvironment: env.GetEnvOrDefault("DEPLOYMENT_ENVIRONMENT", ""),
+		ResourceAttributes:    env.GetEnvOrDefault("OTEL_RESOURCE_ATTRIBUTES", ""),
+		Exporter:              env.GetEnvOrDefault("TELEMETRY_EXPORTER", ExporterOTLP),
+		Endpoint:              env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_ENDPOINT", ""),
+		TracesEndpoint:        env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", ""),
+		MetricsEndpoint:       env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_METRICS_ENDPOINT", ""),
+		LogsEndpoint:          env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_LOGS_ENDPOINT", ""),
+		Protocol:              protocol,
+		TracesProtocol:        env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", protocol),
+		MetricsProtocol:       env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", protocol),
+		LogsProtocol:          env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", protocol),
+		Headers:               env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_HEADERS", ""),
+		TracesHeaders:         env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_TRACES_HEADERS", ""),
+		MetricsHeaders:        env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_METRICS_HEADERS", ""),
+		LogsHeaders:           env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_LOGS_HEADERS", ""),
+		Insecure:              env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_INSECURE", ""),
+		Certificate:           env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_CERTIFICATE", ""),
+		ClientCertificate:     env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE", ""),
+		ClientKey:             env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_CLIENT_KEY", ""),
+		TLSServerName:         env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_TLS_SERVER_NAME", ""),
+		Fallback:              env.GetEnvOrDefault("OTEL_EXPORTER_OTLP_FALLBACK", ""),
+		Sampler:               env.GetEnvOrDefault("OTEL_TRACES_SAMPLER", ""),
+		SamplerArg:            env.GetEnvOrDefault("OTEL_TRACES_SAMPLER_ARG", ""),
+		SamplerKeepErrors:     env.GetBoolOrDefault("OTEL_TRACES_SAMPLER_KEEP_ERRORS", false),
+		SamplerKeepRoutes:     env.GetListOrDefault("OTEL_TRACES_SAMPLER_KEEP_ROUTES", []string{}),
+		Propagators:           env.GetListOrDefault("OTEL_PROPAGATORS", defaultPropagators),
+	}
+}
+
+// signalEndpoint returns the endpoint set for a single signal, if any
+func (c Config) signalEndpoint(signal string) string {
+	switch signal {
+	case signalTraces:
+		return c.TracesEndpoint
+	case signalMetrics:
+		return c.MetricsEndpoint
+	default:
+		return c.LogsEndpoint
+	}
+}
+
+// signalHeaders returns the headers set for a single signal, if any
+func (c Config) signalHeaders(signal string) string {
+	switch signal {
+	case signalTraces:
+		return c.TracesHeaders
+	case signalMetrics:
+		return c.MetricsHeaders
+	default:
+		return c.LogsHeaders
+	}
+}
+
+// Validate checks the settings, returning all the invalid ones, so an invalid
+// one fails at startup instead of disabling the telemetry.
+func (c Config) Validate() error {
+	var errs []error
+	switch c.Exporter {
+	case ExporterOTLP, ExporterOTLPGRPC, ExporterOTLPHTTP, ExporterStdout, ExporterNone:
+	default:
+		errs = append(errs, fmt.Errorf("TELEMETRY_EXPORTER has an unknown exporter %q", c.Exporter))
+	}
+	for _, protocol := range []struct{ key, value string }{
+		{"OTEL_EXPORTER_OTLP_PROTOCOL", c.Protocol},
+		{"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", c.TracesProtocol},
+		{"OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", c.MetricsProtocol},
+		{"OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", c.LogsProtocol},
+	} {
+		if protocol.value != ProtocolGRPC && protocol.value != ProtocolHTTPProtobuf {
+			errs = append(errs, fmt.Errorf("%s must be %s or %s, got %q", protocol.key, ProtocolGRPC, ProtocolHTTPProtobuf, protocol.value))
+		}
+	}
+	if _, err := parseKeyValues(c.ResourceAttributes); err != nil {
+		errs = append(errs, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err))
+	}
+	if _, err := NewSampler(c); err != nil {
+		errs = append(errs, fmt.Errorf("OTEL_TRACES_SAMPLER: %w", err))
+	}
+	if _, err := NewPropagator(c.Propagators); err != nil {
+		errs = append(errs, fmt.Errorf("OTEL_PROPAGATORS: %w", err))
+	}
+	if c.Fallback != "" && c.Fallback != ExporterStdout {
+		errs = append(errs, fmt.Errorf("OTEL_EXPORTER_OTLP_FALLBACK must be %s, got %q", ExporterStdout, c.Fallback))
+	}
+	if protocols, ok := otlpProtocols(c); ok {
+		if _, err := newTLSConfig(c); err != nil {
+			errs = append(errs, err)
+		}
+		for _, signal := range []string{signalTraces, signalMetrics, signalLogs} {
+			if _, err := newSignalConfig(c, protocols[signal], signal); err != nil {
+				errs = append(errs, fmt.Errorf("%s exporter: %w", signal, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// parseKeyValues parses a list of W3C Baggage formatted key=value pairs
+// (e.g. "api-key=secret,tenant=a%20b"). The errors do not quote the values,
+// which may hold credentials.
+func parseKeyValues(raw string) (map[string]string, error) {
+	values := map[string]string{}
+	for _, pair := range strings.Split(raw, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || key == "" {
+			return nil, errors.New("invalid entry, must be key=value")
+		}
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %q, it must be URL encoded", key)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,113 @@
+package telemetry
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+// Exporter sets selectable through TELEMETRY_EXPORTER. "otlp" uses the
+// protocol set by OTEL_EXPORTER_OTLP_PROTOCOL, or by
+// OTEL_EXPORTER_OTLP_<SIGNAL>_PROTOCOL for a single signal.
+const (
+	ExporterOTLP     = "otlp"
+	ExporterOTLPGRPC = "otlp-grpc"
+	ExporterOTLPHTTP = "otlp-http"
+	ExporterStdout   = "stdout"
+	ExporterNone     = "none"
+)
+
+// exporterSet builds the exporters of every signal. A nil exporter means the
+// signal is not exported.
+type exporterSet interface {
+	name() string
+	traceExporter(ctx context.Context) (sdktrace.SpanExporter, error)
+	metricExporter(ctx context.Context) (sdkmetric.Exporter, error)
+	logExporter(ctx context.Context) (sdklog.Exporter, error)
+	// connection returns the gRPC connection to the collector, if any.
+	connection() *grpc.ClientConn
+	Close() error
+}
+
+func newExporterSet(config Config) (exporterSet, error) {
+	if protocols, ok := otlpProtocols(config); ok {
+		return newOTLPExporters(config, protocols)
+	}
+	switch config.Exporter {
+	case ExporterStdout:
+		return stdoutExporters{}, nil
+	case ExporterNone:
+		return noneExporters{}, nil
+	default:
+		return nil, fmt.Errorf("unsupported telemetry exporter: %q", config.Exporter)
+	}
+}
+
+// otlpProtocols returns the protocol of each signal when the exporter is one
+// of the OTLP exporters
+func otlpProtocols(config Config) (map[string]string, bool) {
+	switch config.Exporter {
+	case ExporterOTLP:
+		return map[string]string{
+			signalTraces:  config.TracesProtocol,
+			signalMetrics: config.MetricsProtocol,
+			signalLogs:    config.LogsProtocol,
+		}, true
+	case ExporterOTLPGRPC:
+		return sameProtocol(ProtocolGRPC), true
+	case ExporterOTLPHTTP:
+		return sameProtocol(ProtocolHTTPProtobuf), true
+	default:
+		return nil, false
+	}
+}
+
+// stdoutExporters writes every signal to stdout, useful for local debugging.
+type stdoutExporters struct{}
+
+func (stdoutExporters) name() string { return ExporterStdout }
+
+func (stdoutExporters) traceExporter(context.Context) (sdktrace.SpanExporter, error) {
+	return stdouttrace.New()
+}
+
+func (stdoutExporters) metricExporter(context.Context) (sdkmetric.Exporter, error) {
+	return stdoutmetric.New()
+}
+
+func (stdoutExporters) logExporter(context.Context) (sdklog.Exporter, error) {
+	return stdoutlog.New()
+}
+
+func (stdoutExporters) connection() *grpc.ClientConn { return nil }
+
+func (stdoutExporters) Close() error { return nil }
+
+// noneExporters disables the export, spans are still created so the trace
+// context is propagated to the upstream services.
+type noneExporters struct{}
+
+func (noneExporters) name() string { return ExporterNone }
+
+func (noneExporters) traceExporter(context.Context) (sdktrace.SpanExporter, error) {
+	return nil, nil
+}
+
+func (noneExporters) metricExporter(context.Context) (sdkmetric.Exporter, error) {
+	return nil, nil
+}
+
+func (noneExporters) logExporter(context.Context) (sdklog.Exporter, error) {
+	return nil, nil
+}
+
+func (noneExporters) connection() *grpc.ClientConn { return nil }
+
+func (noneExporters) Close() error { return nil }
@@ -0,0 +1,16 @@
+package telemetry
+
+import (
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/resource"
+)
+
+// initLoggerProvider builds a LoggerProvider batching records to the given
+// exporter, when there is one.
+func initLoggerProvider(res *resource.Resource, exporter sdklog.Exporter) *sdklog.LoggerProvider {
+	opts := []sdklog.LoggerProviderOption{sdklog.WithResource(res)}
+	if exporter != nil {
+		opts = append(opts, sdklog.WithProcessor(sdklog.NewBatchProcessor(exporter)))
+	}
+	return sdklog.NewLoggerProvider(opts...)
+}
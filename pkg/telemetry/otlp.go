@@ -0,0 +1,304 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/backoff"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Protocols supported by OTEL_EXPORTER_OTLP_PROTOCOL, used when
+// TELEMETRY_EXPORTER is "otlp".
+const (
+	ProtocolGRPC         = "grpc"
+	ProtocolHTTPProtobuf = "http/protobuf"
+)
+
+// Default collector endpoints of each protocol, used when no endpoint is set
+const (
+	DefaultGRPCEndpoint = "localhost:4317"
+	DefaultHTTPEndpoint = "localhost:4318"
+)
+
+// DefaultEndpoint returns the default collector endpoint of protocol
+func DefaultEndpoint(protocol string) string {
+	if protocol == ProtocolHTTPProtobuf {
+		return DefaultHTTPEndpoint
+	}
+	return DefaultGRPCEndpoint
+}
+
+// Signals exported to the collector, as used in the OTLP env var names and
+// in the default HTTP URL paths.
+const (
+	signalTraces  = "traces"
+	signalMetrics = "metrics"
+	signalLogs    = "logs"
+)
+
+// otlpExporters builds the OTLP exporters of every signal using the protocol
+// of each signal. The signals using gRPC share a connection per collector
+// endpoint.
+type otlpExporters struct {
+	config Config
+	// protocols maps each signal to its protocol.
+	protocols map[string]string
+	tlsConfig *tls.Config
+	// conns maps each signal using gRPC to the connection to its endpoint.
+	conns map[string]*grpc.ClientConn
+}
+
+// sameProtocol uses protocol for every signal
+func sameProtocol(protocol string) map[string]string {
+	return map[string]string{signalTraces: protocol, signalMetrics: protocol, signalLogs: protocol}
+}
+
+func newOTLPExporters(config Config, protocols map[string]string) (*otlpExporters, error) {
+	tlsConfig, err := newTLSConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	e := &otlpExporters{config: config, protocols: protocols, tlsConfig: tlsConfig, conns: map[string]*grpc.ClientConn{}}
+	for signal, protocol := range protocols {
+		switch protocol {
+		case ProtocolGRPC, ProtocolHTTPProtobuf:
+		default:
+			return nil, fmt.Errorf("unsupported OTLP protocol for %s: %q", signal, protocol)
+		}
+	}
+
+	byEndpoint := map[string]*grpc.ClientConn{}
+	for _, signal := range []string{signalTraces, signalMetrics, signalLogs} {
+		if protocols[signal] != ProtocolGRPC {
+			continue
+		}
+		cfg, err := newSignalConfig(config, ProtocolGRPC, signal)
+		if err != nil {
+			return nil, errors.Join(err, e.Close())
+		}
+		conn, ok := byEndpoint[cfg.endpoint]
+		if !ok {
+			if conn, err = e.dial(cfg); err != nil {
+				return nil, errors.Join(err, e.Close())
+			}
+			byEndpoint[cfg.endpoint] = conn
+		}
+		e.conns[signal] = conn
+	}
+	return e, nil
+}
+
+// dial creates the gRPC connection to the endpoint of a signal. It is
+// established in the background and retried with backoff, so an unreachable
+// collector does not prevent the startup.
+func (e *otlpExporters) dial(cfg signalConfig) (*grpc.ClientConn, error) {
+	// Like the HTTP exporters, an https endpoint uses TLS even without any
+	// TLS setting
+	transportCredentials := insecure.NewCredentials()
+	if e.tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(e.tlsConfig)
+	} else if !cfg.insecure {
+		transportCredentials = credentials.NewTLS(&tls.Config{MinVersion: tls.VersionTLS12})
+	}
+	conn, err := grpc.NewClient(cfg.endpoint,
+		grpc.WithTransportCredentials(transportCredentials),
+		grpc.WithConnectParams(grpc.ConnectParams{
+			Backoff:           backoff.DefaultConfig,
+			MinConnectTimeout: 5 * time.Second,
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection to collector %s: %w", cfg.endpoint, err)
+	}
+	conn.Connect()
+	return conn, nil
+}
+
+// collectorURL returns the collector endpoint, defaulting to the standard
+// port of protocol
+func collectorURL(config Config, protocol string) string {
+	if config.Endpoint == "" {
+		return DefaultEndpoint(protocol)
+	}
+	return config.Endpoint
+}
+
+func (e *otlpExporters) traceExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	cfg, err := newSignalConfig(e.config, e.protocols[signalTraces], signalTraces)
+	if err != nil {
+		return nil, err
+	}
+	if e.protocols[signalTraces] == ProtocolGRPC {
+		return otlptracegrpc.New(ctx,
+			otlptracegrpc.WithGRPCConn(e.conns[signalTraces]),
+			otlptracegrpc.WithHeaders(cfg.headers),
+		)
+	}
+	opts := []otlptracehttp.Option{
+		otlptracehttp.WithEndpoint(cfg.endpoint),
+		otlptracehttp.WithURLPath(cfg.urlPath),
+		otlptracehttp.WithHeaders(cfg.headers),
+	}
+	if e.tlsConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(e.tlsConfig))
+	} else if cfg.insecure {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	return otlptracehttp.New(ctx, opts...)
+}
+
+func (e *otlpExporters) metricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	cfg, err := newSignalConfig(e.config, e.protocols[signalMetrics], signalMetrics)
+	if err != nil {
+		return nil, err
+	}
+	if e.protocols[signalMetrics] == ProtocolGRPC {
+		return otlpmetricgrpc.New(ctx,
+			otlpmetricgrpc.WithGRPCConn(e.conns[signalMetrics]),
+			otlpmetricgrpc.WithHeaders(cfg.headers),
+		)
+	}
+	opts := []otlpmetrichttp.Option{
+		otlpmetrichttp.WithEndpoint(cfg.endpoint),
+		otlpmetrichttp.WithURLPath(cfg.urlPath),
+		otlpmetrichttp.WithHeaders(cfg.headers),
+	}
+	if e.tlsConfig != nil {
+		opts = append(opts, otlpmetrichttp.WithTLSClientConfig(e.tlsConfig))
+	} else if cfg.insecure {
+		opts = append(opts, otlpmetrichttp.WithInsecure())
+	}
+	return otlpmetrichttp.New(ctx, opts...)
+}
+
+func (e *otlpExporters) logExporter(ctx context.Context) (sdklog.Exporter, error) {
+	cfg, err := newSignalConfig(e.config, e.protocols[signalLogs], signalLogs)
+	if err != nil {
+		return nil, err
+	}
+	if e.protocols[signalLogs] == ProtocolGRPC {
+		return otlploggrpc.New(ctx,
+			otlploggrpc.WithGRPCConn(e.conns[signalLogs]),
+			otlploggrpc.WithHeaders(cfg.headers),
+		)
+	}
+	opts := []otlploghttp.Option{
+		otlploghttp.WithEndpoint(cfg.endpoint),
+		otlploghttp.WithURLPath(cfg.urlPath),
+		otlploghttp.WithHeaders(cfg.headers),
+	}
+	if e.tlsConfig != nil {
+		opts = append(opts, otlploghttp.WithTLSClientConfig(e.tlsConfig))
+	} else if cfg.insecure {
+		opts = append(opts, otlploghttp.WithInsecure())
+	}
+	return otlploghttp.New(ctx, opts...)
+}
+
+// name reports the protocol of the traces, which are the signal whose state
+// is monitored
+func (e *otlpExporters) name() string {
+	if e.protocols[signalTraces] == ProtocolGRPC {
+		return ExporterOTLPGRPC
+	}
+	return ExporterOTLPHTTP
+}
+
+// connection returns the gRPC connection of the traces, if any
+func (e *otlpExporters) connection() *grpc.ClientConn {
+	return e.conns[signalTraces]
+}
+
+// Close releases the gRPC connections, if any.
+func (e *otlpExporters) Close() error {
+	var errs []error
+	closed := map[*grpc.ClientConn]bool{}
+	for _, conn := range e.conns {
+		if !closed[conn] {
+			closed[conn] = true
+			errs = append(errs, conn.Close())
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// signalConfig holds the per signal settings following the OTLP exporter
+// spec: the OTEL_EXPORTER_OTLP_<SIGNAL>_* settings take precedence over the
+// generic ones.
+type signalConfig struct {
+	endpoint string
+	urlPath  string
+	insecure bool
+	headers  map[string]string
+}
+
+// newSignalConfig returns the settings of signal, exported using protocol.
+// The errors name the invalid setting.
+func newSignalConfig(config Config, protocol, signal string) (signalConfig, error) {
+	envSignal := strings.ToUpper(signal)
+
+	// A signal specific endpoint is used as is, while the generic one is a
+	// base URL which gets the signal path appended.
+	rawURL := config.signalEndpoint(signal)
+	appendPath := rawURL == ""
+	if appendPath {
+		rawURL = collectorURL(config, protocol)
+	}
+	u, err := parseEndpoint(rawURL)
+	if err != nil {
+		return signalConfig{}, err
+	}
+	urlPath := u.Path
+	if appendPath {
+		urlPath = strings.TrimSuffix(urlPath, "/") + "/v1/" + signal
+	}
+
+	headers, err := parseKeyValues(config.Headers)
+	if err != nil {
+		return signalConfig{}, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS: %w", err)
+	}
+	signalHeaders, err := parseKeyValues(config.signalHeaders(signal))
+	if err != nil {
+		return signalConfig{}, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_%s_HEADERS: %w", envSignal, err)
+	}
+	for k, v := range signalHeaders {
+		headers[k] = v
+	}
+
+	return signalConfig{
+		endpoint: u.Host,
+		urlPath:  urlPath,
+		insecure: u.Scheme != "https",
+		headers:  headers,
+	}, nil
+}
+
+// parseEndpoint parses the collector endpoint, which may omit the scheme
+// (e.g. "otel-collector:4317").
+func parseEndpoint(rawURL string) (*url.URL, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "http://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: %w", rawURL, err)
+	}
+	return u, nil
+}
@@ -0,0 +1,69 @@
+package telemetry
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestOTLPGRPCSignalEndpoints(t *testing.T) {
+	collector := startCollector(t, nil)
+	tracesCollector := startCollector(t, nil)
+	tests := []struct {
+		name   string
+		config Config
+		// wantConns is the amount of connections opened
+		wantConns int
+		// wantCollector and wantTracesCollector are the spans each receives
+		wantCollector       int
+		wantTracesCollector int
+	}{
+		{
+			name:          "shared endpoint",
+			config:        Config{Endpoint: collector.addr},
+			wantConns:     1,
+			wantCollector: 1,
+		},
+		{
+			name:                "traces endpoint",
+			config:              Config{Endpoint: collector.addr, TracesEndpoint: "http://" + tracesCollector.addr},
+			wantConns:           2,
+			wantTracesCollector: 1,
+		},
+		{
+			name:          "metrics and logs endpoints",
+			config:        Config{Endpoint: collector.addr, MetricsEndpoint: tracesCollector.addr, LogsEndpoint: tracesCollector.addr},
+			wantConns:     2,
+			wantCollector: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before, beforeTraces := collector.spans(), tracesCollector.spans()
+			exporters, err := newOTLPExporters(tt.config, sameProtocol(ProtocolGRPC))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exporters.Close()
+
+			conns := map[any]bool{}
+			for _, conn := range exporters.conns {
+				conns[conn] = true
+			}
+			if len(conns) != tt.wantConns {
+				t.Errorf("got %d connections, want %d", len(conns), tt.wantConns)
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			if err := exportSpan(ctx, exporters); err != nil {
+				t.Fatal(err)
+			}
+			if got := collector.spans() - before; got != tt.wantCollector {
+				t.Errorf("collector got %d spans, want %d", got, tt.wantCollector)
+			}
+			if got := tracesCollector.spans() - beforeTraces; got != tt.wantTracesCollector {
+				t.Errorf("traces collector got %d spans, want %d", got, tt.wantTracesCollector)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package telemetry
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/contrib/propagators/jaeger"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+var (
+	defaultPropagators = []string{"tracecontext", "baggage"}
+
+	propagatorsMu sync.RWMutex
+	propagators   = map[string]func() propagation.TextMapPropagator{
+		"tracecontext": func() propagation.TextMapPropagator { return propagation.TraceContext{} },
+		"baggage":      func() propagation.TextMapPropagator { return propagation.Baggage{} },
+		"b3":           func() propagation.TextMapPropagator { return b3.New() },
+		"b3multi": func() propagation.TextMapPropagator {
+			return b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader))
+		},
+		"jaeger": func() propagation.TextMapPropagator { return jaeger.Jaeger{} },
+	}
+)
+
+// RegisterPropagator makes a propagator available to OTEL_PROPAGATORS under
+// the given name, replacing any propagator previously registered with it.
+func RegisterPropagator(name string, factory func() propagation.TextMapPropagator) {
+	propagatorsMu.Lock()
+	defer propagatorsMu.Unlock()
+	propagators[name] = factory
+}
+
+// NewPropagator creates the composite propagator of the given names, as
+// listed by OTEL_PROPAGATORS (e.g. "tracecontext,baggage,b3"), which defaults
+// to "tracecontext,baggage". The "none" value disables propagation.
+func NewPropagator(names []string) (propagation.TextMapPropagator, error) {
+	if len(names) == 0 {
+		names = defaultPropagators
+	}
+
+	propagatorsMu.RLock()
+	defer propagatorsMu.RUnlock()
+
+	var selected []propagation.TextMapPropagator
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		if name == "none" {
+			return propagation.NewCompositeTextMapPropagator(), nil
+		}
+		factory, ok := propagators[name]
+		if !ok {
+			return nil, fmt.Errorf("unsupported propagator: %q", name)
+		}
+		selected = append(selected, factory())
+	}
+	return propagation.NewCompositeTextMapPropagator(selected...), nil
+}
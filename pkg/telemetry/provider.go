@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/log/global"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Provider holds the traces, metrics and logs pipelines of a service.
+type Provider struct {
+	TracerProvider *sdktrace.TracerProvider
+	MeterProvider  *sdkmetric.MeterProvider
+	LoggerProvider *sdklog.LoggerProvider
+	exporters      exporterSet
+}
+
+// InitProvider sets up the telemetry pipelines, using the exporter set chosen
+// by the config, and registers them globally. Make sure to call Shutdown on
+// the returned Provider for proper cleanup.
+func InitProvider(ctx context.Context, serviceName string, config Config) (*Provider, error) {
+	res, err := newResource(ctx, serviceName, config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resource: %w", err)
+	}
+
+	propagator, err := NewPropagator(config.Propagators)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTextMapPropagator(propagator)
+
+	exporters, err := newExporterSet(config)
+	if err != nil {
+		return nil, err
+	}
+	provider, err := newProvider(ctx, res, exporters, config)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(provider.TracerProvider)
+	otel.SetMeterProvider(provider.MeterProvider)
+	global.SetLoggerProvider(provider.LoggerProvider)
+
+	return provider, nil
+}
+
+// newProvider builds the pipelines of every signal on top of exporters. On
+// failure the exporters already created are shut down and exporters is
+// closed.
+func newProvider(ctx context.Context, res *resource.Resource, exporters exporterSet, config Config) (*Provider, error) {
+	var traceExporter sdktrace.SpanExporter
+	var metricExporter sdkmetric.Exporter
+	var logExporter sdklog.Exporter
+	cleanup := func(err error) error {
+		errs := []error{err}
+		if traceExporter != nil {
+			errs = append(errs, traceExporter.Shutdown(ctx))
+		}
+		if metricExporter != nil {
+			errs = append(errs, metricExporter.Shutdown(ctx))
+		}
+		if logExporter != nil {
+			errs = append(errs, logExporter.Shutdown(ctx))
+		}
+		return errors.Join(append(errs, exporters.Close())...)
+	}
+
+	traceExporter, err := exporters.traceExporter(ctx)
+	if err != nil {
+		return nil, cleanup(fmt.Errorf("failed to create trace exporter: %w", err))
+	}
+	metricExporter, err = exporters.metricExporter(ctx)
+	if err != nil {
+		return nil, cleanup(fmt.Errorf("failed to create metric exporter: %w", err))
+	}
+	logExporter, err = exporters.logExporter(ctx)
+	if err != nil {
+		return nil, cleanup(fmt.Errorf("failed to create log exporter: %w", err))
+	}
+
+	tracerProvider, err := initTracerProvider(res, traceExporter, exporters, config)
+	if err != nil {
+		return nil, cleanup(err)
+	}
+	return &Provider{
+		TracerProvider: tracerProvider,
+		MeterProvider:  initMeterProvider(res, metricExporter),
+		LoggerProvider: initLoggerProvider(res, logExporter),
+		exporters:      exporters,
+	}, nil
+}
+
+// ForceFlush exports all the telemetry not exported yet.
+func (p *Provider) ForceFlush(ctx context.Context) error {
+	return errors.Join(
+		p.TracerProvider.ForceFlush(ctx),
+		p.MeterProvider.ForceFlush(ctx),
+		p.LoggerProvider.ForceFlush(ctx),
+	)
+}
+
+// Shutdown flushes the pending telemetry and releases the exporters.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	return errors.Join(
+		p.TracerProvider.Shutdown(ctx),
+		p.MeterProvider.Shutdown(ctx),
+		p.LoggerProvider.Shutdown(ctx),
+		p.exporters.Close(),
+	)
+}
@@ -0,0 +1,233 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/internal/telemetrytest"
+	"go.opentelemetry.io/otel/log"
+	sdklog "go.opentelemetry.io/otel/sdk/log"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"google.golang.org/grpc"
+)
+
+// memoryExporters is an exporterSet keeping every signal in memory. The
+// exporters of the signals listed on fail can not be created.
+type memoryExporters struct {
+	fail map[string]bool
+
+	spans   *memorySpanExporter
+	metrics *memoryMetricExporter
+	logs    *telemetrytest.LogExporter
+	closed  bool
+}
+
+func newMemoryExporters(fail ...string) *memoryExporters {
+	e := &memoryExporters{
+		fail:    map[string]bool{},
+		spans:   &memorySpanExporter{InMemoryExporter: tracetest.NewInMemoryExporter()},
+		metrics: &memoryMetricExporter{},
+		logs:    &telemetrytest.LogExporter{},
+	}
+	for _, signal := range fail {
+		e.fail[signal] = true
+	}
+	return e
+}
+
+var errCreate = errors.New("can not create exporter")
+
+func (e *memoryExporters) name() string { return "memory" }
+
+func (e *memoryExporters) traceExporter(context.Context) (sdktrace.SpanExporter, error) {
+	if e.fail[signalTraces] {
+		return nil, errCreate
+	}
+	return e.spans, nil
+}
+
+func (e *memoryExporters) metricExporter(context.Context) (sdkmetric.Exporter, error) {
+	if e.fail[signalMetrics] {
+		return nil, errCreate
+	}
+	return e.metrics, nil
+}
+
+func (e *memoryExporters) logExporter(context.Context) (sdklog.Exporter, error) {
+	if e.fail[signalLogs] {
+		return nil, errCreate
+	}
+	return e.logs, nil
+}
+
+func (e *memoryExporters) connection() *grpc.ClientConn { return nil }
+
+func (e *memoryExporters) Close() error {
+	e.closed = true
+	return nil
+}
+
+type memorySpanExporter struct {
+	*tracetest.InMemoryExporter
+	shutdown bool
+}
+
+func (e *memorySpanExporter) Shutdown(ctx context.Context) error {
+	e.shutdown = true
+	// The embedded exporter forgets the spans on shutdown
+	return nil
+}
+
+type memoryMetricExporter struct {
+	mu       sync.Mutex
+	metrics  []metricdata.ResourceMetrics
+	shutdown bool
+}
+
+func (e *memoryMetricExporter) Temporality(kind sdkmetric.InstrumentKind) metricdata.Temporality {
+	return sdkmetric.DefaultTemporalitySelector(kind)
+}
+
+func (e *memoryMetricExporter) Aggregation(kind sdkmetric.InstrumentKind) sdkmetric.Aggregation {
+	return sdkmetric.DefaultAggregationSelector(kind)
+}
+
+func (e *memoryMetricExporter) Export(_ context.Context, rm *metricdata.ResourceMetrics) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.metrics = append(e.metrics, *rm)
+	return nil
+}
+
+func (e *memoryMetricExporter) ForceFlush(context.Context) error { return nil }
+
+func (e *memoryMetricExporter) Shutdown(context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdown = true
+	return nil
+}
+
+// exported returns the amount of metrics exported
+func (e *memoryMetricExporter) exported() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	count := 0
+	for _, rm := range e.metrics {
+		for _, sm := range rm.ScopeMetrics {
+			count += len(sm.Metrics)
+		}
+	}
+	return count
+}
+
+// emit records a span, a metric and a log through provider
+func emit(ctx context.Context, provider *Provider) {
+	_, span := provider.TracerProvider.Tracer("test").Start(ctx, "span")
+	span.End()
+	counter, _ := provider.MeterProvider.Meter("test").Int64Counter("requests")
+	counter.Add(ctx, 1)
+	var record log.Record
+	record.SetBody(log.StringValue("message"))
+	provider.LoggerProvider.Logger("test").Emit(ctx, record)
+}
+
+func TestProviderFlushAndShutdown(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(*Provider, context.Context) error
+		// wantShutdown tells whether the exporters must be shut down
+		wantShutdown bool
+	}{
+		{name: "ForceFlush", close: (*Provider).ForceFlush},
+		{name: "Shutdown", close: (*Provider).Shutdown, wantShutdown: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			exporters := newMemoryExporters()
+			provider, err := newProvider(ctx, resource.Empty(), exporters, Config{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			emit(ctx, provider)
+			if err := tt.close(provider, ctx); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := len(exporters.spans.GetSpans()); got != 1 {
+				t.Errorf("got %d spans, want 1", got)
+			}
+			if got := exporters.metrics.exported(); got != 1 {
+				t.Errorf("got %d metrics, want 1", got)
+			}
+			if got := exporters.logs.Len(); got != 1 {
+				t.Errorf("got %d logs, want 1", got)
+			}
+			shutdown := []bool{exporters.spans.shutdown, exporters.metrics.shutdown, exporters.logs.IsShutdown(), exporters.closed}
+			for i, got := range shutdown {
+				if got != tt.wantShutdown {
+					t.Errorf("exporter %d shut down %v, want %v", i, got, tt.wantShutdown)
+				}
+			}
+			if !tt.wantShutdown {
+				provider.Shutdown(ctx)
+			}
+		})
+	}
+}
+
+func TestNewProviderReleasesExportersOnError(t *testing.T) {
+	tests := []struct {
+		name   string
+		fail   []string
+		config Config
+		// wantShutdown lists the exporters created before the failure
+		wantShutdown []string
+	}{
+		{name: "trace exporter", fail: []string{signalTraces}},
+		{name: "metric exporter", fail: []string{signalMetrics}, wantShutdown: []string{signalTraces}},
+		{name: "log exporter", fail: []string{signalLogs}, wantShutdown: []string{signalTraces, signalMetrics}},
+		{
+			name:         "tracer provider",
+			config:       Config{Sampler: "sometimes"},
+			wantShutdown: []string{signalTraces, signalMetrics, signalLogs},
+		},
+		{
+			name:         "fallback exporter",
+			config:       Config{Fallback: "kafka"},
+			wantShutdown: []string{signalTraces, signalMetrics, signalLogs},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exporters := newMemoryExporters(tt.fail...)
+			if _, err := newProvider(context.Background(), resource.Empty(), exporters, tt.config); err == nil {
+				t.Fatal("expected an error")
+			}
+			want := map[string]bool{}
+			for _, signal := range tt.wantShutdown {
+				want[signal] = true
+			}
+			got := map[string]bool{
+				signalTraces:  exporters.spans.shutdown,
+				signalMetrics: exporters.metrics.shutdown,
+				signalLogs:    exporters.logs.IsShutdown(),
+			}
+			for signal := range got {
+				if got[signal] != want[signal] {
+					t.Errorf("%s exporter shut down %v, want %v", signal, got[signal], want[signal])
+				}
+			}
+			if !exporters.closed {
+				t.Error("exporter set not closed")
+			}
+		})
+	}
+}
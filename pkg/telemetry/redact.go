@@ -0,0 +1,117 @@
+package telemetry
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/redact"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// urlAttributes are the span attributes holding a full URL, set by otelhttp
+// depending on the semantic conventions version.
+var urlAttributes = map[attribute.Key]struct{}{
+	"url.full": {},
+	"http.url": {},
+}
+
+// headerAttributePrefixes prefix the span attributes holding a header.
+var headerAttributePrefixes = []string{"http.request.header.", "http.response.header."}
+
+// redactExporter removes the secrets, such as the API keys in the URL of the
+// client spans created by otelhttp, from the spans before exporting them.
+type redactExporter struct {
+	sdktrace.SpanExporter
+}
+
+func newRedactExporter(exporter sdktrace.SpanExporter) sdktrace.SpanExporter {
+	if exporter == nil {
+		return nil
+	}
+	return redactExporter{SpanExporter: exporter}
+}
+
+func (e redactExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	redacted := make([]sdktrace.ReadOnlySpan, len(spans))
+	for i, span := range spans {
+		redacted[i] = redactSpan(span)
+	}
+	return e.SpanExporter.ExportSpans(ctx, redacted)
+}
+
+// redactedSpan overrides the attributes, events and status of a span
+type redactedSpan struct {
+	sdktrace.ReadOnlySpan
+	attributes []attribute.KeyValue
+	events     []sdktrace.Event
+	status     sdktrace.Status
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue { return s.attributes }
+
+func (s redactedSpan) Events() []sdktrace.Event { return s.events }
+
+func (s redactedSpan) Status() sdktrace.Status { return s.status }
+
+// redactSpan returns the span itself when there is nothing to redact
+func redactSpan(span sdktrace.ReadOnlySpan) sdktrace.ReadOnlySpan {
+	attributes, attributesChanged := redactAttributes(span.Attributes())
+	events := span.Events()
+	eventsChanged := false
+	for i, event := range events {
+		if eventAttributes, changed := redactAttributes(event.Attributes); changed {
+			if !eventsChanged {
+				events = append([]sdktrace.Event(nil), events...)
+				eventsChanged = true
+			}
+			events[i].Attributes = eventAttributes
+		}
+	}
+	status := span.Status()
+	description := redact.String(status.Description)
+	if !attributesChanged && !eventsChanged && description == status.Description {
+		return span
+	}
+	status.Description = description
+	return redactedSpan{ReadOnlySpan: span, attributes: attributes, events: events, status: status}
+}
+
+// redactAttributes returns a redacted copy of the attributes, if any changed
+func redactAttributes(attributes []attribute.KeyValue) ([]attribute.KeyValue, bool) {
+	var redacted []attribute.KeyValue
+	for i, attr := range attributes {
+		value, ok := redactAttribute(attr)
+		if !ok {
+			continue
+		}
+		if redacted == nil {
+			redacted = append([]attribute.KeyValue(nil), attributes...)
+		}
+		redacted[i] = attribute.String(string(attr.Key), value)
+	}
+	if redacted == nil {
+		return attributes, false
+	}
+	return redacted, true
+}
+
+// redactAttribute returns the redacted value of an attribute, if it changed
+func redactAttribute(attr attribute.KeyValue) (string, bool) {
+	if _, ok := urlAttributes[attr.Key]; ok {
+		value := attr.Value.Emit()
+		redacted := redact.URL(value)
+		return redacted, redacted != value
+	}
+	for _, prefix := range headerAttributePrefixes {
+		if name, ok := strings.CutPrefix(string(attr.Key), prefix); ok && redact.Header(strings.ReplaceAll(name, "_", "-")) {
+			return redact.Replacement, true
+		}
+	}
+	if attr.Value.Type() == attribute.STRING {
+		value := attr.Value.AsString()
+		redacted := redact.String(value)
+		return redacted, redacted != value
+	}
+	return "", false
+}
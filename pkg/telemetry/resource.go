@@ -0,0 +1,104 @@
+package telemetry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/resource"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+)
+
+// newResource describes the service emitting the telemetry. Attributes set
+// through OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME take precedence
+// over the detected ones.
+func newResource(ctx context.Context, serviceName string, config Config) (*resource.Resource, error) {
+	attrs := []attribute.KeyValue{
+		semconv.ServiceName(serviceName),
+		semconv.ServiceVersion(serviceVersion(config)),
+	}
+	if config.DeploymentEnvironment != "" {
+		attrs = append(attrs, semconv.DeploymentEnvironment(config.DeploymentEnvironment))
+	}
+	configured, err := configuredAttributes(config)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithSchemaURL(semconv.SchemaURL),
+		resource.WithAttributes(attrs...),
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		// Command args are left out as they may carry secrets
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessOwner(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithContainer(),
+		resource.WithAttributes(configured...),
+	)
+	if errors.Is(err, resource.ErrPartialResource) {
+		// Some detectors are expected to fail, e.g. the container ID outside
+		// of a container, the remaining attributes are still useful.
+		logging.Logger.Warn("partial telemetry resource detected", "error", err)
+		return res, nil
+	}
+	return res, err
+}
+
+// configuredAttributes returns the attributes set through
+// OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME
+func configuredAttributes(config Config) ([]attribute.KeyValue, error) {
+	values, err := parseKeyValues(config.ResourceAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTEL_RESOURCE_ATTRIBUTES: %w", err)
+	}
+	attrs := make([]attribute.KeyValue, 0, len(values)+1)
+	for key, value := range values {
+		attrs = append(attrs, attribute.String(key, value))
+	}
+	if config.ServiceName != "" {
+		attrs = append(attrs, semconv.ServiceName(config.ServiceName))
+	}
+	return attrs, nil
+}
+
+// serviceVersion returns SERVICE_VERSION when set, falling back to the module
+// version or VCS revision stamped in the binary build info.
+func serviceVersion(config Config) string {
+	if config.ServiceVersion != "" {
+		return config.ServiceVersion
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	var revision, modified string
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			revision = setting.Value
+		case "vcs.modified":
+			modified = setting.Value
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,229 @@
+package telemetry
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/time/rate"
+)
+
+// Samplers supported by OTEL_TRACES_SAMPLER, besides the ones in the spec
+// this also accepts "ratelimiting" and "parentbased_ratelimiting", which take
+// the maximum amount of sampled spans per second as OTEL_TRACES_SAMPLER_ARG
+// (only root spans are limited by the parent based one).
+const (
+	samplerAlwaysOn                = "always_on"
+	samplerAlwaysOff               = "always_off"
+	samplerTraceIDRatio            = "traceidratio"
+	samplerRateLimiting            = "ratelimiting"
+	samplerParentBasedAlwaysOn     = "parentbased_always_on"
+	samplerParentBasedAlwaysOff    = "parentbased_always_off"
+	samplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+	samplerParentBasedRateLimiting = "parentbased_ratelimiting"
+)
+
+// samplingRules lists the spans kept regardless of the sampler decision.
+type samplingRules struct {
+	keepErrors bool
+	routes     map[string]bool
+}
+
+func (r samplingRules) enabled() bool {
+	return r.keepErrors || len(r.routes) > 0
+}
+
+// NewSampler creates the head sampler configured by OTEL_TRACES_SAMPLER and
+// OTEL_TRACES_SAMPLER_ARG, defaulting to parentbased_always_on.
+func NewSampler(config Config) (sdktrace.Sampler, error) {
+	name := strings.ToLower(strings.TrimSpace(config.Sampler))
+	arg := strings.TrimSpace(config.SamplerArg)
+
+	switch name {
+	case samplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case samplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case samplerTraceIDRatio:
+		ratio, err := parseRatio(arg)
+		if err != nil {
+			return nil, err
+		}
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case samplerRateLimiting:
+		limit, err := parseRateLimit(arg)
+		if err != nil {
+			return nil, err
+		}
+		return newRateLimitingSampler(limit), nil
+	case "", samplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case samplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case samplerParentBasedTraceIDRatio:
+		ratio, err := parseRatio(arg)
+		if err != nil {
+			return nil, err
+		}
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	case samplerParentBasedRateLimiting:
+		limit, err := parseRateLimit(arg)
+		if err != nil {
+			return nil, err
+		}
+		return sdktrace.ParentBased(newRateLimitingSampler(limit)), nil
+	default:
+		return nil, fmt.Errorf("unsupported sampler: %q", name)
+	}
+}
+
+// newSamplingRules returns the rules keeping spans dropped by the sampler:
+//
+//   - OTEL_TRACES_SAMPLER_KEEP_ERRORS: keeps every span with an error status
+//   - OTEL_TRACES_SAMPLER_KEEP_ROUTES: comma separated routes (e.g. /weather)
+//     whose spans are kept when answering with a 5xx status code
+func newSamplingRules(config Config) samplingRules {
+	rules := samplingRules{keepErrors: config.SamplerKeepErrors}
+	for _, route := range config.SamplerKeepRoutes {
+		if route = strings.TrimSpace(route); route != "" {
+			if rules.routes == nil {
+				rules.routes = map[string]bool{}
+			}
+			rules.routes[route] = true
+		}
+	}
+	return rules
+}
+
+func parseRatio(arg string) (float64, error) {
+	if arg == "" {
+		return 1, nil
+	}
+	ratio, err := strconv.ParseFloat(arg, 64)
+	if err != nil || ratio < 0 || ratio > 1 {
+		return 0, fmt.Errorf("invalid sampler ratio %q, must be between 0 and 1", arg)
+	}
+	return ratio, nil
+}
+
+func parseRateLimit(arg string) (float64, error) {
+	limit, err := strconv.ParseFloat(arg, 64)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("invalid sampler rate limit %q, must be a positive number of traces per second", arg)
+	}
+	return limit, nil
+}
+
+// rateLimitingSampler samples at most limit traces per second.
+type rateLimitingSampler struct {
+	limiter     *rate.Limiter
+	description string
+}
+
+func newRateLimitingSampler(limit float64) sdktrace.Sampler {
+	burst := int(limit)
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimitingSampler{
+		limiter:     rate.NewLimiter(rate.Limit(limit), burst),
+		description: fmt.Sprintf("RateLimitingSampler{%g}", limit),
+	}
+}
+
+func (s *rateLimitingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	decision := sdktrace.Drop
+	if s.limiter.Allow() {
+		decision = sdktrace.RecordAndSample
+	}
+	return sdktrace.SamplingResult{
+		Decision:   decision,
+		Tracestate: trace.SpanContextFromContext(p.ParentContext).TraceState(),
+	}
+}
+
+func (s *rateLimitingSampler) Description() string {
+	return s.description
+}
+
+// recordingSampler records the spans dropped by the wrapped sampler, so the
+// sampling rules can still keep them once they end.
+type recordingSampler struct {
+	sdktrace.Sampler
+}
+
+func (s recordingSampler) ShouldSample(p sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	result := s.Sampler.ShouldSample(p)
+	if result.Decision == sdktrace.Drop {
+		result.Decision = sdktrace.RecordOnly
+	}
+	return result
+}
+
+func (s recordingSampler) Description() string {
+	return "RecordingSampler{" + s.Sampler.Description() + "}"
+}
+
+// rulesSpanProcessor forwards the sampled spans and the recorded ones matching
+// the sampling rules to the wrapped processor.
+type rulesSpanProcessor struct {
+	sdktrace.SpanProcessor
+	rules samplingRules
+}
+
+func (p *rulesSpanProcessor) OnEnd(s sdktrace.ReadOnlySpan) {
+	if s.SpanContext().IsSampled() {
+		p.SpanProcessor.OnEnd(s)
+		return
+	}
+	if p.keep(s) {
+		p.SpanProcessor.OnEnd(keptSpan{s})
+	}
+}
+
+func (p *rulesSpanProcessor) keep(s sdktrace.ReadOnlySpan) bool {
+	if p.rules.keepErrors && s.Status().Code == codes.Error {
+		return true
+	}
+	if len(p.rules.routes) == 0 {
+		return false
+	}
+	var route string
+	var statusCode int64
+	for _, attr := range s.Attributes() {
+		switch attr.Key {
+		case "http.route":
+			route = attr.Value.AsString()
+		case "http.status_code", "http.response.status_code":
+			statusCode = attr.Value.AsInt64()
+		}
+	}
+	return p.rules.routes[route] && statusCode >= 500
+}
+
+// keptSpan flags a recorded span as sampled so it gets exported. The decision
+// is taken once the span ends, after its context was already propagated as
+// not sampled, so the spans of the downstream services and of its children
+// are not kept along with it, unless the rules keep them as well.
+type keptSpan struct {
+	sdktrace.ReadOnlySpan
+}
+
+func (s keptSpan) SpanContext() trace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
+
+// keptAttribute marks the spans exported due to the sampling rules.
+var keptAttribute = attribute.Bool("sampling.rule_kept", true)
+
+func (s keptSpan) Attributes() []attribute.KeyValue {
+	// The attributes are copied as the slice may be shared with the span
+	spanAttrs := s.ReadOnlySpan.Attributes()
+	attrs := make([]attribute.KeyValue, 0, len(spanAttrs)+1)
+	return append(append(attrs, spanAttrs...), keptAttribute)
+}
@@ -0,0 +1,136 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rcbadiale/go_open_telemetry/pkg/logging"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+)
+
+// ExporterState describes how the span export to the collector is going, so
+// operators can see whether spans are being dropped.
+type ExporterState struct {
+	Enabled       bool      `json:"enabled"`
+	Exporter      string    `json:"exporter,omitempty"`
+	Connection    string    `json:"connection,omitempty"`
+	Healthy       bool      `json:"healthy"`
+	Fallback      string    `json:"fallback,omitempty"`
+	ExportedSpans int64     `json:"exported_spans"`
+	FallbackSpans int64     `json:"fallback_spans"`
+	DroppedSpans  int64     `json:"dropped_spans"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitempty"`
+	LastSuccessAt time.Time `json:"last_success_at,omitempty"`
+}
+
+// monitoredExporter wraps the span exporter keeping track of its state and
+// sending the spans to the fallback exporter, if any, when the export fails.
+type monitoredExporter struct {
+	next     sdktrace.SpanExporter
+	fallback sdktrace.SpanExporter
+	conn     *grpc.ClientConn
+
+	mu    sync.Mutex
+	state ExporterState
+}
+
+var (
+	currentExporterMu sync.RWMutex
+	currentExporter   *monitoredExporter
+)
+
+func newMonitoredExporter(next, fallback sdktrace.SpanExporter, exporterName, fallbackName string, conn *grpc.ClientConn) *monitoredExporter {
+	m := &monitoredExporter{
+		next:     next,
+		fallback: fallback,
+		conn:     conn,
+		state: ExporterState{
+			Enabled:  true,
+			Exporter: exporterName,
+			Fallback: fallbackName,
+			Healthy:  true,
+		},
+	}
+	currentExporterMu.Lock()
+	currentExporter = m
+	currentExporterMu.Unlock()
+	return m
+}
+
+func (m *monitoredExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	err := m.next.ExportSpans(ctx, spans)
+	if err == nil {
+		m.update(func(s *ExporterState) {
+			if !s.Healthy {
+				logging.Logger.Info("telemetry exporter recovered", "exporter", s.Exporter)
+			}
+			s.Healthy = true
+			s.ExportedSpans += int64(len(spans))
+			s.LastSuccessAt = time.Now()
+		})
+		return nil
+	}
+
+	m.update(func(s *ExporterState) {
+		if s.Healthy {
+			logging.Logger.Warn("telemetry exporter failing, spans are being dropped", "exporter", s.Exporter, "error", err)
+		}
+		s.Healthy = false
+		s.LastError = err.Error()
+		s.LastErrorAt = time.Now()
+	})
+	if m.fallback != nil && m.fallback.ExportSpans(ctx, spans) == nil {
+		m.update(func(s *ExporterState) { s.FallbackSpans += int64(len(spans)) })
+		return nil
+	}
+	m.update(func(s *ExporterState) { s.DroppedSpans += int64(len(spans)) })
+	return err
+}
+
+// Shutdown shuts down both exporters, even when the fallback fails
+func (m *monitoredExporter) Shutdown(ctx context.Context) error {
+	var fallbackErr error
+	if m.fallback != nil {
+		fallbackErr = m.fallback.Shutdown(ctx)
+	}
+	return errors.Join(fallbackErr, m.next.Shutdown(ctx))
+}
+
+func (m *monitoredExporter) update(fn func(*ExporterState)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn(&m.state)
+}
+
+func (m *monitoredExporter) snapshot() ExporterState {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	state := m.state
+	if m.conn != nil {
+		state.Connection = m.conn.GetState().String()
+	}
+	return state
+}
+
+// State returns the current state of the span exporter.
+func State() ExporterState {
+	currentExporterMu.RLock()
+	defer currentExporterMu.RUnlock()
+	if currentExporter == nil {
+		return ExporterState{}
+	}
+	return currentExporter.snapshot()
+}
+
+// StateHandler reports the span exporter state as JSON.
+func StateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(State())
+}
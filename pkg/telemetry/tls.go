@@ -0,0 +1,78 @@
+package telemetry
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// newTLSConfig builds the TLS settings used to reach the collector from the
+// OTEL_EXPORTER_OTLP_* settings:
+//
+//   - OTEL_EXPORTER_OTLP_CERTIFICATE: CA bundle used to verify the collector
+//   - OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE / OTEL_EXPORTER_OTLP_CLIENT_KEY:
+//     client key pair used for mTLS
+//   - OTEL_EXPORTER_OTLP_TLS_SERVER_NAME: overrides the expected server name
+//   - OTEL_EXPORTER_OTLP_INSECURE: forces plaintext (or TLS when false), it
+//     can not be true along with any of the settings above
+//
+// A nil config means the connection is plaintext, which is still the default
+// when the endpoint is not https and no TLS settings are provided.
+func newTLSConfig(config Config) (*tls.Config, error) {
+	caFile := config.Certificate
+	certFile := config.ClientCertificate
+	keyFile := config.ClientKey
+	serverName := config.TLSServerName
+
+	u, err := parseEndpoint(config.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	tlsSettings := caFile != "" || certFile != "" || keyFile != "" || serverName != ""
+	secure := u.Scheme == "https" || tlsSettings
+	if value := config.Insecure; value != "" {
+		insecure, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_INSECURE: %w", err)
+		}
+		// Sending the telemetry in plaintext while certificates are set is
+		// most likely a mistake
+		if insecure && tlsSettings {
+			return nil, errors.New("OTEL_EXPORTER_OTLP_INSECURE=true conflicts with the OTEL_EXPORTER_OTLP certificate, client key and TLS server name settings")
+		}
+		secure = !insecure
+	}
+	if !secure {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: serverName,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read collector CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no valid certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, errors.New("both OTEL_EXPORTER_OTLP_CLIENT_CERTIFICATE and OTEL_EXPORTER_OTLP_CLIENT_KEY must be set for mTLS")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load collector client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
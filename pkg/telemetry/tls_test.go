@@ -0,0 +1,330 @@
+package telemetry
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	collectortrace "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/protobuf/proto"
+)
+
+// fakeCollector is a stand-in OTLP gRPC collector keeping the received spans
+type fakeCollector struct {
+	collectortrace.UnimplementedTraceServiceServer
+
+	addr string
+
+	mu       sync.Mutex
+	requests []*collectortrace.ExportTraceServiceRequest
+	// clientCerts are the amount of requests sent with a client certificate
+	clientCerts int
+}
+
+// startCollector starts a fakeCollector, using TLS when tlsConfig is set
+func startCollector(t *testing.T, tlsConfig *tls.Config) *fakeCollector {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var opts []grpc.ServerOption
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	server := grpc.NewServer(opts...)
+	collector := &fakeCollector{addr: listener.Addr().String()}
+	collectortrace.RegisterTraceServiceServer(server, collector)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+	return collector
+}
+
+func (c *fakeCollector) Export(ctx context.Context, req *collectortrace.ExportTraceServiceRequest) (*collectortrace.ExportTraceServiceResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.requests = append(c.requests, req)
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(info.State.PeerCertificates) > 0 {
+			c.clientCerts++
+		}
+	}
+	return &collectortrace.ExportTraceServiceResponse{}, nil
+}
+
+// spans returns the amount of spans received
+func (c *fakeCollector) spans() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	count := 0
+	for _, req := range c.requests {
+		for _, resourceSpans := range req.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				count += len(scopeSpans.Spans)
+			}
+		}
+	}
+	return count
+}
+
+// clientCertRequests returns the amount of requests sent with a client
+// certificate
+func (c *fakeCollector) clientCertRequests() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.clientCerts
+}
+
+// payload returns every received request in the wire format
+func (c *fakeCollector) payload(t *testing.T) string {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var b strings.Builder
+	for _, req := range c.requests {
+		data, err := proto.Marshal(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Write(data)
+	}
+	return b.String()
+}
+
+// certs holds a CA and the server and client key pairs it signed, written as
+// PEM files
+type certs struct {
+	caFile, serverCertFile, serverKeyFile, clientCertFile, clientKeyFile string
+	pool                                                                 *x509.CertPool
+	server                                                               tls.Certificate
+}
+
+func newCerts(t *testing.T) certs {
+	t.Helper()
+	dir := t.TempDir()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issue := func(serial int64, usage x509.ExtKeyUsage, name string) (string, string) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: name},
+			DNSNames:     []string{"localhost", "collector.test"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keyDER, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certFile := writePEM(t, filepath.Join(dir, name+".crt"), "CERTIFICATE", der)
+		keyFile := writePEM(t, filepath.Join(dir, name+".key"), "EC PRIVATE KEY", keyDER)
+		return certFile, keyFile
+	}
+
+	c := certs{caFile: writePEM(t, filepath.Join(dir, "ca.crt"), "CERTIFICATE", caDER), pool: x509.NewCertPool()}
+	c.pool.AddCert(ca)
+	c.serverCertFile, c.serverKeyFile = issue(2, x509.ExtKeyUsageServerAuth, "server")
+	c.clientCertFile, c.clientKeyFile = issue(3, x509.ExtKeyUsageClientAuth, "client")
+	c.server, err = tls.LoadX509KeyPair(c.serverCertFile, c.serverKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func writePEM(t *testing.T, path, blockType string, der []byte) string {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// exportSpan sends a single span through the trace exporter of exporters
+func exportSpan(ctx context.Context, exporters exporterSet) error {
+	exporter, err := exporters.traceExporter(ctx)
+	if err != nil {
+		return err
+	}
+	defer exporter.Shutdown(context.Background())
+	return exporter.ExportSpans(ctx, tracetest.SpanStubs{{Name: "span"}}.Snapshots())
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	c := newCerts(t)
+	tests := []struct {
+		name   string
+		config Config
+		// mTLS makes the collector require a client certificate
+		mTLS bool
+		// wantConfigErr is part of the error building the exporters
+		wantConfigErr string
+		wantExported  bool
+		wantClientTLS bool
+	}{
+		{
+			name:         "CA bundle verifies the collector",
+			config:       Config{Certificate: c.caFile},
+			wantExported: true,
+		},
+		{
+			name:         "server name override",
+			config:       Config{Certificate: c.caFile, TLSServerName: "collector.test"},
+			wantExported: true,
+		},
+		{
+			name: "mTLS with a client certificate",
+			config: Config{
+				Certificate:       c.caFile,
+				ClientCertificate: c.clientCertFile,
+				ClientKey:         c.clientKeyFile,
+			},
+			mTLS:          true,
+			wantExported:  true,
+			wantClientTLS: true,
+		},
+		{
+			name:   "mTLS without a client certificate",
+			config: Config{Certificate: c.caFile},
+			mTLS:   true,
+		},
+		{
+			name:   "collector not trusted by the system pool",
+			config: Config{Insecure: "false"},
+		},
+		{
+			name:   "plaintext to a TLS collector",
+			config: Config{Insecure: "true"},
+		},
+		{
+			name:          "insecure conflicts with a CA bundle",
+			config:        Config{Insecure: "true", Certificate: c.caFile},
+			wantConfigErr: "conflicts",
+		},
+		{
+			name:          "insecure conflicts with a client certificate",
+			config:        Config{Insecure: "1", ClientCertificate: c.clientCertFile, ClientKey: c.clientKeyFile},
+			wantConfigErr: "conflicts",
+		},
+		{
+			name:          "client certificate without its key",
+			config:        Config{ClientCertificate: c.clientCertFile},
+			wantConfigErr: "must be set for mTLS",
+		},
+		{
+			name:          "missing CA bundle",
+			config:        Config{Certificate: filepath.Join(t.TempDir(), "missing.crt")},
+			wantConfigErr: "failed to read collector CA certificate",
+		},
+		{
+			name:          "invalid insecure flag",
+			config:        Config{Insecure: "maybe"},
+			wantConfigErr: "invalid OTEL_EXPORTER_OTLP_INSECURE",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			serverConfig := &tls.Config{Certificates: []tls.Certificate{c.server}, MinVersion: tls.VersionTLS12}
+			if tt.mTLS {
+				serverConfig.ClientAuth = tls.RequireAndVerifyClientCert
+				serverConfig.ClientCAs = c.pool
+			}
+			collector := startCollector(t, serverConfig)
+
+			tt.config.Endpoint = collector.addr
+			exporters, err := newOTLPExporters(tt.config, sameProtocol(ProtocolGRPC))
+			if tt.wantConfigErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantConfigErr) {
+					t.Fatalf("got error %v, want it to contain %q", err, tt.wantConfigErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exporters.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			err = exportSpan(ctx, exporters)
+			if exported := collector.spans() == 1; exported != tt.wantExported {
+				t.Fatalf("exported %v (error %v), want %v", exported, err, tt.wantExported)
+			}
+			if tt.wantExported && err != nil {
+				t.Fatal(err)
+			}
+			if clientTLS := collector.clientCertRequests() > 0; clientTLS != tt.wantClientTLS {
+				t.Errorf("client certificate sent %v, want %v", clientTLS, tt.wantClientTLS)
+			}
+		})
+	}
+}
+
+// Plaintext collectors keep working when no TLS setting is provided
+func TestNewTLSConfigPlaintext(t *testing.T) {
+	collector := startCollector(t, nil)
+	exporters, err := newOTLPExporters(Config{Endpoint: collector.addr}, sameProtocol(ProtocolGRPC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer exporters.Close()
+	if exporters.tlsConfig != nil {
+		t.Fatal("expected a plaintext connection")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := exportSpan(ctx, exporters); err != nil {
+		t.Fatal(err)
+	}
+	if collector.spans() != 1 {
+		t.Fatalf("got %d spans, want 1", collector.spans())
+	}
+}
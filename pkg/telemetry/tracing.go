@@ -1,54 +1,49 @@
 package telemetry
 
 import (
-	"context"
 	"fmt"
-	"time"
 
-	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
-	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
-	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
 )
 
-func InitProvider(ctx context.Context, serviceName, collectorURL string) (func(context.Context) error, error) {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			semconv.ServiceName(serviceName),
-		),
-	)
+// initTracerProvider builds a TracerProvider batching the sampled spans to the
+// given exporter, when there is one.
+func initTracerProvider(res *resource.Resource, exporter sdktrace.SpanExporter, exporters exporterSet, config Config) (*sdktrace.TracerProvider, error) {
+	sampler, err := NewSampler(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC connection to collector: %w", err)
+		return nil, err
 	}
-
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
-	defer cancel()
-
-	conn, err := grpc.DialContext(ctx, collectorURL,
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithBlock(),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create gRPC connection to collector: %w", err)
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithResource(res)}
+	if exporter == nil {
+		return sdktrace.NewTracerProvider(append(opts, sdktrace.WithSampler(sampler))...), nil
 	}
 
-	traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn))
-	if err != nil {
-		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	rules := newSamplingRules(config)
+	fallbackName := config.Fallback
+	var fallbackExporter sdktrace.SpanExporter
+	switch fallbackName {
+	case "":
+	case ExporterStdout:
+		fallbackExporter, err = stdouttrace.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create fallback exporter: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported fallback exporter: %q", fallbackName)
 	}
 
-	bsp := sdktrace.NewBatchSpanProcessor(traceExporter)
-	traceProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithSampler(sdktrace.AlwaysSample()),
-		sdktrace.WithResource(res),
+	var bsp sdktrace.SpanProcessor = sdktrace.NewBatchSpanProcessor(newMonitoredExporter(
+		newRedactExporter(exporter), newRedactExporter(fallbackExporter), exporters.name(), fallbackName, exporters.connection(),
+	))
+	if rules.enabled() {
+		// Dropped spans must still be recorded to be evaluated by the rules
+		sampler = recordingSampler{sampler}
+		bsp = &rulesSpanProcessor{SpanProcessor: bsp, rules: rules}
+	}
+	return sdktrace.NewTracerProvider(append(opts,
+		sdktrace.WithSampler(sampler),
 		sdktrace.WithSpanProcessor(bsp),
-	)
-	otel.SetTracerProvider(traceProvider)
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	return traceProvider.Shutdown, nil
+	)...), nil
 }